@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
@@ -28,5 +33,58 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to load config")
 	}
 	log.Debug().Str("configfile", *configPath).Msg("Config loaded")
-	processor.Run(conf)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	processor.Run(ctx, conf, watchConfig(ctx, *configPath, *strictConfig))
+}
+
+// configPollInterval is how often the config file is checked for modifications
+const configPollInterval = 5 * time.Second
+
+// watchConfig re-reads the config when SIGHUP is received or when the config file is modified. Configs that fail to
+// load are logged and ignored
+func watchConfig(ctx context.Context, configPath string, strict bool) <-chan config.Config {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	reloads := make(chan config.Config)
+	modified := func() time.Time {
+		info, err := os.Stat(configPath)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	go func() {
+		defer signal.Stop(hup)
+		lastModified := modified()
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Info().Str("configfile", configPath).Msg("SIGHUP received, reloading config")
+				lastModified = modified()
+			case <-ticker.C:
+				m := modified()
+				if m.IsZero() || m.Equal(lastModified) {
+					continue
+				}
+				lastModified = m
+				log.Info().Str("configfile", configPath).Msg("Config file modified, reloading config")
+			}
+			conf, err := config.ReadConfig(configPath, strict)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to reload config, keeping the current config")
+				continue
+			}
+			select {
+			case reloads <- conf:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return reloads
 }
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Diagnostics of RuuviBridge itself, exposed by the prometheus sink when enabled. The mac addresses in the received
+// packets are not used as labels, since anyone nearby can broadcast packets with arbitrary mac addresses
+
+var MacMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ruuvibridge_mac_mismatches_total",
+	Help: "Number of measurements where the MAC address embedded in the data did not match the reported MAC address, by the action taken",
+}, []string{"action"})
+
+var ParseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ruuvibridge_parse_failures_total",
+	Help: "Number of packets that failed to parse, by the attempted data format and the reason of the failure",
+}, []string{"data_format", "reason"})
+
+var GatewayPolls = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ruuvibridge_gateway_polls_total",
+	Help: "Number of polls to gateways by gateway_polling, by the name of the gateway and the result of the poll",
+}, []string{"gateway", "result"})
+
+var OutlierRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ruuvibridge_outlier_rejections_total",
+	Help: "Number of values rejected by the outlier rejection, by the field, the reason (bounds, rate or spike) and the action (nulled or dropped)",
+}, []string{"field", "reason", "action"})
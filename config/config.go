@@ -10,14 +10,24 @@ import (
 )
 
 type GatewayPolling struct {
-	Enabled     *bool         `yaml:"enabled,omitempty"`
+	Enabled     *bool                  `yaml:"enabled,omitempty"`
+	Name        string                 `yaml:"name,omitempty"`
+	GatewayUrl  string                 `yaml:"gateway_url"`
+	BearerToken string                 `yaml:"bearer_token"`
+	Interval    time.Duration          `yaml:"interval"`
+	Gateways    []GatewayPollingTarget `yaml:"gateways,omitempty"`
+}
+
+type GatewayPollingTarget struct {
+	Name        string        `yaml:"name,omitempty"`
 	GatewayUrl  string        `yaml:"gateway_url"`
-	BearerToken string        `yaml:"bearer_token"`
-	Interval    time.Duration `yaml:"interval"`
+	BearerToken string        `yaml:"bearer_token,omitempty"`
+	Interval    time.Duration `yaml:"interval,omitempty"`
 }
 
 type MQTTListener struct {
 	Enabled           *bool  `yaml:"enabled,omitempty"`
+	Name              string `yaml:"name,omitempty"`
 	BrokerUrl         string `yaml:"broker_url"`
 	BrokerAddress     string `yaml:"broker_address"`
 	BrokerPort        int    `yaml:"broker_port"`
@@ -31,16 +41,69 @@ type MQTTListener struct {
 }
 
 type HTTPListener struct {
-	Enabled *bool `yaml:"enabled,omitempty"`
-	Port    int   `yaml:"port"`
+	Enabled     *bool  `yaml:"enabled,omitempty"`
+	Name        string `yaml:"name,omitempty"`
+	Port        int    `yaml:"port"`
+	BindAddress string `yaml:"bind_address,omitempty"`
+	Username    string `yaml:"username,omitempty"`
+	Password    string `yaml:"password,omitempty"`
+	BearerToken string `yaml:"bearer_token,omitempty"`
+	TLSCertFile string `yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `yaml:"tls_key_file,omitempty"`
+	MaxBodySize int64  `yaml:"max_body_size,omitempty"`
+}
+
+type BluezLog struct {
+	Enabled *bool  `yaml:"enabled,omitempty"`
+	Name    string `yaml:"name,omitempty"`
+	File    string `yaml:"file"`
+}
+
+type Replay struct {
+	Enabled *bool    `yaml:"enabled,omitempty"`
+	File    string   `yaml:"file"`
+	Speed   *float64 `yaml:"speed,omitempty"`
+}
+
+type Recorder struct {
+	Enabled  *bool  `yaml:"enabled,omitempty"`
+	File     string `yaml:"file"`
+	MaxSize  int64  `yaml:"max_size,omitempty"`
+	MaxFiles int    `yaml:"max_files,omitempty"`
+}
+
+type OutlierField struct {
+	Min          *float64 `yaml:"min,omitempty"`
+	Max          *float64 `yaml:"max,omitempty"`
+	MaxRate      *float64 `yaml:"max_rate,omitempty"`
+	MADThreshold *float64 `yaml:"mad_threshold,omitempty"`
+}
+
+type OutlierRejection struct {
+	Action string                  `yaml:"action,omitempty"`
+	Window int                     `yaml:"window,omitempty"`
+	Fields map[string]OutlierField `yaml:"fields"`
 }
 
 type Processing struct {
-	ExtendedValues    *bool    `yaml:"extended_values,omitempty"`
-	FilterMode        string   `yaml:"filter_mode"`
-	FilterList        []string `yaml:"filter_list"`
-	DisableFormats    []string `yaml:"disable_formats"`
-	IncludeUnofficial bool     `yaml:"include_unofficial"`
+	ExtendedValues    *bool             `yaml:"extended_values,omitempty"`
+	FilterMode        string            `yaml:"filter_mode"`
+	FilterList        []string          `yaml:"filter_list"`
+	DisableFormats    []string          `yaml:"disable_formats"`
+	IncludeUnofficial bool              `yaml:"include_unofficial"`
+	MacMismatch       string            `yaml:"mac_mismatch"`
+	GatewayFilterMode string            `yaml:"gateway_filter_mode"`
+	GatewayFilterList []string          `yaml:"gateway_filter_list"`
+	DedupeWindow      time.Duration     `yaml:"dedupe_window,omitempty"`
+	OutlierRejection  *OutlierRejection `yaml:"outlier_rejection,omitempty"`
+}
+
+type SinkFilter struct {
+	FilterMode     string   `yaml:"filter_mode,omitempty"`
+	FilterList     []string `yaml:"filter_list,omitempty"`
+	DisableFormats []string `yaml:"disable_formats,omitempty"`
+	IncludeFields  []string `yaml:"include_fields,omitempty"`
+	ExcludeFields  []string `yaml:"exclude_fields,omitempty"`
 }
 
 type InfluxDBPublisher struct {
@@ -52,6 +115,8 @@ type InfluxDBPublisher struct {
 	Bucket          string            `yaml:"bucket"`
 	Measurement     string            `yaml:"measurement"`
 	AdditionalTags  map[string]string `yaml:"additional_tags,omitempty"`
+	SourceTags      bool              `yaml:"source_tags,omitempty"`
+	SinkFilter      `yaml:",inline"`
 }
 
 type InfluxDB3Publisher struct {
@@ -62,12 +127,17 @@ type InfluxDB3Publisher struct {
 	Database        string            `yaml:"database"`
 	Measurement     string            `yaml:"measurement"`
 	AdditionalTags  map[string]string `yaml:"additional_tags,omitempty"`
+	SourceTags      bool              `yaml:"source_tags,omitempty"`
+	SinkFilter      `yaml:",inline"`
 }
 
 type Prometheus struct {
-	Enabled                 *bool  `yaml:"enabled,omitempty"`
-	Port                    int    `yaml:"port"`
-	MeasurementMetricPrefix string `yaml:"measurement_metric_prefix"`
+	Enabled                 *bool    `yaml:"enabled,omitempty"`
+	Port                    int      `yaml:"port"`
+	MeasurementMetricPrefix string   `yaml:"measurement_metric_prefix"`
+	SourceLabels            bool     `yaml:"source_labels,omitempty"`
+	MetadataLabels          []string `yaml:"metadata_labels,omitempty"`
+	SinkFilter              `yaml:",inline"`
 }
 
 type MQTTPublisher struct {
@@ -86,6 +156,7 @@ type MQTTPublisher struct {
 	LWTTopic                     string        `yaml:"lwt_topic"`
 	LWTOnlinePayload             string        `yaml:"lwt_online_payload"`
 	LWTOfflinePayload            string        `yaml:"lwt_offline_payload"`
+	SinkFilter                   `yaml:",inline"`
 }
 
 type Logging struct {
@@ -95,18 +166,59 @@ type Logging struct {
 	WithCaller bool   `yaml:"with_caller,omitempty"`
 }
 
+type Tag struct {
+	Name     string            `yaml:"name,omitempty"`
+	Location string            `yaml:"location,omitempty"`
+	Room     string            `yaml:"room,omitempty"`
+	Floor    string            `yaml:"floor,omitempty"`
+	Owner    string            `yaml:"owner,omitempty"`
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+}
+
+type CalibrationPoint struct {
+	Raw    float64 `yaml:"raw"`
+	Actual float64 `yaml:"actual"`
+}
+
+type Calibration struct {
+	Offset float64            `yaml:"offset,omitempty"`
+	Scale  *float64           `yaml:"scale,omitempty"`
+	Points []CalibrationPoint `yaml:"points,omitempty"`
+}
+
+type TagCalibration struct {
+	Temperature   *Calibration `yaml:"temperature,omitempty"`
+	Humidity      *Calibration `yaml:"humidity,omitempty"`
+	Pressure      *Calibration `yaml:"pressure,omitempty"`
+	AccelerationX *Calibration `yaml:"acceleration_x,omitempty"`
+	AccelerationY *Calibration `yaml:"acceleration_y,omitempty"`
+	AccelerationZ *Calibration `yaml:"acceleration_z,omitempty"`
+	CO2           *Calibration `yaml:"co2,omitempty"`
+	Pm1p0         *Calibration `yaml:"pm1p0,omitempty"`
+	Pm2p5         *Calibration `yaml:"pm2p5,omitempty"`
+	Pm4p0         *Calibration `yaml:"pm4p0,omitempty"`
+	Pm10p0        *Calibration `yaml:"pm10p0,omitempty"`
+}
+
 type Config struct {
-	GatewayPolling     *GatewayPolling     `yaml:"gateway_polling,omitempty"`
-	MQTTListener       *MQTTListener       `yaml:"mqtt_listener,omitempty"`
-	HTTPListener       *HTTPListener       `yaml:"http_listener,omitempty"`
-	Processing         *Processing         `yaml:"processing,omitempty"`
-	InfluxDBPublisher  *InfluxDBPublisher  `yaml:"influxdb_publisher,omitempty"`
-	InfluxDB3Publisher *InfluxDB3Publisher `yaml:"influxdb3_publisher,omitempty"`
-	Prometheus         *Prometheus         `yaml:"prometheus,omitempty"`
-	MQTTPublisher      *MQTTPublisher      `yaml:"mqtt_publisher,omitempty"`
-	TagNames           map[string]string   `yaml:"tag_names,omitempty"`
-	Logging            Logging             `yaml:"logging"`
-	Debug              bool                `yaml:"debug"`
+	GatewayPolling     *GatewayPolling           `yaml:"gateway_polling,omitempty"`
+	MQTTListener       *MQTTListener             `yaml:"mqtt_listener,omitempty"`
+	HTTPListener       *HTTPListener             `yaml:"http_listener,omitempty"`
+	BluezLog           *BluezLog                 `yaml:"bluez_log,omitempty"`
+	Replay             *Replay                   `yaml:"replay,omitempty"`
+	Recorder           *Recorder                 `yaml:"recorder,omitempty"`
+	Processing         *Processing               `yaml:"processing,omitempty"`
+	InfluxDBPublisher  *InfluxDBPublisher        `yaml:"influxdb_publisher,omitempty"`
+	InfluxDB3Publisher *InfluxDB3Publisher       `yaml:"influxdb3_publisher,omitempty"`
+	Prometheus         *Prometheus               `yaml:"prometheus,omitempty"`
+	MQTTPublisher      *MQTTPublisher            `yaml:"mqtt_publisher,omitempty"`
+	TagNames           map[string]string         `yaml:"tag_names,omitempty"`
+	Tags               map[string]Tag            `yaml:"tags,omitempty"`
+	EncryptionKeys     map[string]string         `yaml:"encryption_keys,omitempty"`
+	Calibration        map[string]TagCalibration `yaml:"calibration,omitempty"`
+	Logging            Logging                   `yaml:"logging"`
+	ShutdownTimeout    time.Duration             `yaml:"shutdown_timeout,omitempty"`
+	Debug              bool                      `yaml:"debug"`
 }
 
 func ReadConfig(configFile string, strict bool) (Config, error) {
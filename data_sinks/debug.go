@@ -7,10 +7,12 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func Debug() chan<- parser.Measurement {
+func Debug() (chan<- parser.Measurement, <-chan struct{}) {
 	log.Info().Msg("Starting debug sink")
 	measurements := make(chan parser.Measurement, 1024)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for measurement := range measurements {
 			data, err := json.Marshal(measurement)
 			if err != nil {
@@ -26,5 +28,5 @@ func Debug() chan<- parser.Measurement {
 			}
 		}
 	}()
-	return measurements
+	return measurements, done
 }
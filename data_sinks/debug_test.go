@@ -0,0 +1,42 @@
+package data_sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestDebug_DataFormatName(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = logger }()
+
+	temperature := 21.5
+	m := parser.Measurement{}
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.DataFormatName = "BTHome"
+	m.Temperature = &temperature
+
+	measurements, done := Debug()
+	measurements <- m
+	close(measurements)
+	<-done
+
+	var fields map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if err := json.Unmarshal(line, &fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fields["data_format_name"] != "BTHome" {
+		t.Errorf("expected the data format name in the output, got %v", fields)
+	}
+	if fields["temperature"] != 21.5 {
+		t.Errorf("expected the temperature in the output, got %v", fields)
+	}
+}
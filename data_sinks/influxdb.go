@@ -3,7 +3,10 @@ package data_sinks
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Scrin/RuuviBridge/common/limiter"
@@ -14,7 +17,32 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
+// influxReservedTags are the InfluxDB tags set from the measurement, which the tag metadata must not override
+var influxReservedTags = []string{"dataFormat", "mac", "name", "gatewayMac", "sourceType", "sourceName"}
+
+// ValidateInfluxTags checks that the metadata of the tags, published as InfluxDB tags by the influxdb sinks, does not
+// use the keys reserved for the tags set from the measurement, nor the keys of the additional tags of the sink
+func ValidateInfluxTags(tags map[string]config.Tag, additionalTags map[string]string) error {
+	for mac, tag := range tags {
+		keys := slices.Collect(maps.Keys(tag.Metadata))
+		for key, value := range map[string]string{"location": tag.Location, "room": tag.Room, "floor": tag.Floor, "owner": tag.Owner} {
+			if value != "" {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			if slices.Contains(influxReservedTags, key) {
+				return fmt.Errorf("metadata key %q of %s is reserved in InfluxDB", key, mac)
+			}
+			if _, ok := additionalTags[key]; ok {
+				return fmt.Errorf("metadata key %q of %s is already set in additional_tags", key, mac)
+			}
+		}
+	}
+	return nil
+}
+
+func InfluxDB(conf config.InfluxDBPublisher) (chan<- parser.Measurement, <-chan struct{}) {
 	url := conf.Url
 	if url == "" {
 		url = "https://localhost:8086"
@@ -39,15 +67,19 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 
 	limiter := limiter.New(conf.MinimumInterval)
 	measurements := make(chan parser.Measurement, 1024)
+	done := make(chan struct{})
 	go func() {
+		var writes sync.WaitGroup
 		for measurement := range measurements {
 			if !limiter.Check(measurement) {
 				log.Trace().Str("mac", measurement.Mac).Msg("Skipping InfluxDB publish due to interval limit")
 				continue
 			}
+			writes.Add(1)
 			go func(measurement parser.Measurement) {
+				defer writes.Done()
 				p := influxdb.NewPointWithMeasurement(measurementName).
-					AddTag("dataFormat", fmt.Sprintf("%X", measurement.DataFormat)).
+					AddTag("dataFormat", measurement.FormatName()).
 					AddTag("mac", strings.ReplaceAll(measurement.Mac, ":", ""))
 				if measurement.Name != nil {
 					p.AddTag("name", *measurement.Name)
@@ -55,6 +87,22 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 				for tag, value := range conf.AdditionalTags {
 					p.AddTag(tag, value)
 				}
+				for tag, value := range measurement.TagMetadata() {
+					if value != "" {
+						p.AddTag(tag, value)
+					}
+				}
+				if conf.SourceTags {
+					if measurement.GatewayMac != nil {
+						p.AddTag("gatewayMac", strings.ReplaceAll(*measurement.GatewayMac, ":", ""))
+					}
+					if measurement.SourceType != "" {
+						p.AddTag("sourceType", measurement.SourceType)
+					}
+					if measurement.SourceName != "" {
+						p.AddTag("sourceName", measurement.SourceName)
+					}
+				}
 				addFloat(p, "temperature", measurement.Temperature)
 				addFloat(p, "humidity", measurement.Humidity)
 				addFloat(p, "pressure", measurement.Pressure)
@@ -66,6 +114,8 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 				addInt(p, "rssi", measurement.Rssi)
 				addInt(p, "movementCounter", measurement.MovementCounter)
 				addInt(p, "measurementSequenceNumber", measurement.MeasurementSequenceNumber)
+				addInt(p, "continuousSequenceNumber", measurement.ContinuousSequenceNumber)
+				addInt(p, "randomId", measurement.RandomId)
 				addFloat(p, "accelerationTotal", measurement.AccelerationTotal)
 				addFloat(p, "absoluteHumidity", measurement.AbsoluteHumidity)
 				addFloat(p, "dewPoint", measurement.DewPoint)
@@ -87,10 +137,18 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 				addFloat(p, "soundAverage", measurement.SoundAverage)
 				addFloat(p, "soundPeak", measurement.SoundPeak)
 				addFloat(p, "airQualityIndex", measurement.AirQualityIndex)
+				// Third party sensors
+				addFloat(p, "batteryLevel", measurement.BatteryLevel)
+				addFloat(p, "moisture", measurement.Moisture)
+				addBool(p, "motion", measurement.Motion)
+				addBool(p, "opening", measurement.Opening)
 				// Diagnostics
 				addBool(p, "calibrationInProgress", measurement.CalibrationInProgress)
 				addBool(p, "buttonPressedOnBoot", measurement.ButtonPressedOnBoot)
 				addBool(p, "rtcOnBoot", measurement.RtcOnBoot)
+				addBool(p, "macMismatch", measurement.MacMismatch)
+				addInt(p, "parseFailures", measurement.ParseFailures)
+				addInt(p, "gatewayCount", measurement.GatewayCount)
 				p.SetTime(time.Now())
 				err := writeAPI.WritePoint(context.Background(), p)
 				if err != nil {
@@ -98,9 +156,12 @@ func InfluxDB(conf config.InfluxDBPublisher) chan<- parser.Measurement {
 				}
 			}(measurement)
 		}
+		writes.Wait()
 		client.Close()
+		log.Info().Msg("InfluxDB sink stopped")
+		close(done)
 	}()
-	return measurements
+	return measurements, done
 }
 
 func addFloat(p *write.Point, name string, value *float64) {
@@ -2,8 +2,8 @@ package data_sinks
 
 import (
 	"context"
-	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/InfluxCommunity/influxdb3-go/v2/influxdb3"
@@ -13,7 +13,7 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
+func InfluxDB3(conf config.InfluxDB3Publisher) (chan<- parser.Measurement, <-chan struct{}) {
 	url := conf.Url
 	if url == "" {
 		url = "https://localhost:8086"
@@ -40,15 +40,19 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 
 	limiter := limiter.New(conf.MinimumInterval)
 	measurements := make(chan parser.Measurement, 1024)
+	done := make(chan struct{})
 	go func() {
+		var writes sync.WaitGroup
 		for measurement := range measurements {
 			if !limiter.Check(measurement) {
 				log.Trace().Str("mac", measurement.Mac).Msg("Skipping InfluxDB3 publish due to interval limit")
 				continue
 			}
+			writes.Add(1)
 			go func(measurement parser.Measurement) {
+				defer writes.Done()
 				p := influxdb3.NewPointWithMeasurement(measurementName).
-					SetTag("dataFormat", fmt.Sprintf("%X", measurement.DataFormat)).
+					SetTag("dataFormat", measurement.FormatName()).
 					SetTag("mac", strings.ReplaceAll(measurement.Mac, ":", ""))
 				if measurement.Name != nil {
 					p.SetTag("name", *measurement.Name)
@@ -56,6 +60,22 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 				for tag, value := range conf.AdditionalTags {
 					p.SetTag(tag, value)
 				}
+				for tag, value := range measurement.TagMetadata() {
+					if value != "" {
+						p.SetTag(tag, value)
+					}
+				}
+				if conf.SourceTags {
+					if measurement.GatewayMac != nil {
+						p.SetTag("gatewayMac", strings.ReplaceAll(*measurement.GatewayMac, ":", ""))
+					}
+					if measurement.SourceType != "" {
+						p.SetTag("sourceType", measurement.SourceType)
+					}
+					if measurement.SourceName != "" {
+						p.SetTag("sourceName", measurement.SourceName)
+					}
+				}
 				influx3AddFloat(p, "temperature", measurement.Temperature)
 				influx3AddFloat(p, "humidity", measurement.Humidity)
 				influx3AddFloat(p, "pressure", measurement.Pressure)
@@ -67,6 +87,8 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 				influx3AddInt(p, "rssi", measurement.Rssi)
 				influx3AddInt(p, "movementCounter", measurement.MovementCounter)
 				influx3AddInt(p, "measurementSequenceNumber", measurement.MeasurementSequenceNumber)
+				influx3AddInt(p, "continuousSequenceNumber", measurement.ContinuousSequenceNumber)
+				influx3AddInt(p, "randomId", measurement.RandomId)
 				influx3AddFloat(p, "accelerationTotal", measurement.AccelerationTotal)
 				influx3AddFloat(p, "absoluteHumidity", measurement.AbsoluteHumidity)
 				influx3AddFloat(p, "dewPoint", measurement.DewPoint)
@@ -88,10 +110,18 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 				influx3AddFloat(p, "soundAverage", measurement.SoundAverage)
 				influx3AddFloat(p, "soundPeak", measurement.SoundPeak)
 				influx3AddFloat(p, "airQualityIndex", measurement.AirQualityIndex)
+				// Third party sensors
+				influx3AddFloat(p, "batteryLevel", measurement.BatteryLevel)
+				influx3AddFloat(p, "moisture", measurement.Moisture)
+				influx3AddBool(p, "motion", measurement.Motion)
+				influx3AddBool(p, "opening", measurement.Opening)
 				// Diagnostics
 				influx3AddBool(p, "calibrationInProgress", measurement.CalibrationInProgress)
 				influx3AddBool(p, "buttonPressedOnBoot", measurement.ButtonPressedOnBoot)
 				influx3AddBool(p, "rtcOnBoot", measurement.RtcOnBoot)
+				influx3AddBool(p, "macMismatch", measurement.MacMismatch)
+				influx3AddInt(p, "parseFailures", measurement.ParseFailures)
+				influx3AddInt(p, "gatewayCount", measurement.GatewayCount)
 				p.SetTimestamp(time.Now())
 				err := client.WritePoints(context.Background(), []*influxdb3.Point{p})
 				if err != nil {
@@ -99,9 +129,12 @@ func InfluxDB3(conf config.InfluxDB3Publisher) chan<- parser.Measurement {
 				}
 			}(measurement)
 		}
+		writes.Wait()
 		client.Close()
+		log.Info().Msg("InfluxDB3 sink stopped")
+		close(done)
 	}()
-	return measurements
+	return measurements, done
 }
 
 func influx3AddFloat(p *influxdb3.Point, name string, value *float64) {
@@ -13,7 +13,7 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func MQTT(conf config.MQTTPublisher) chan<- parser.Measurement {
+func MQTT(conf config.MQTTPublisher) (chan<- parser.Measurement, <-chan struct{}) {
 	address := conf.BrokerAddress
 	if address == "" {
 		address = "localhost"
@@ -71,6 +71,7 @@ func MQTT(conf config.MQTTPublisher) chan<- parser.Measurement {
 
 	limiter := limiter.New(conf.MinimumInterval)
 	measurements := make(chan parser.Measurement, 1024)
+	done := make(chan struct{})
 	go func() {
 		for measurement := range measurements {
 			if !limiter.Check(measurement) {
@@ -112,6 +113,8 @@ func MQTT(conf config.MQTTPublisher) chan<- parser.Measurement {
 					safePublishI("rssi", measurement.Rssi)
 					safePublishI("movementCounter", measurement.MovementCounter)
 					safePublishI("measurementSequenceNumber", measurement.MeasurementSequenceNumber)
+					safePublishI("continuousSequenceNumber", measurement.ContinuousSequenceNumber)
+					safePublishI("randomId", measurement.RandomId)
 					safePublishF("accelerationTotal", measurement.AccelerationTotal)
 					safePublishF("absoluteHumidity", measurement.AbsoluteHumidity)
 					safePublishF("dewPoint", measurement.DewPoint)
@@ -133,13 +136,32 @@ func MQTT(conf config.MQTTPublisher) chan<- parser.Measurement {
 					safePublishF("soundAverage", measurement.SoundAverage)
 					safePublishF("soundPeak", measurement.SoundPeak)
 					safePublishF("airQualityIndex", measurement.AirQualityIndex)
+					// Third party sensors
+					safePublishF("batteryLevel", measurement.BatteryLevel)
+					safePublishF("moisture", measurement.Moisture)
+					safePublishB("motion", measurement.Motion)
+					safePublishB("opening", measurement.Opening)
 					// Diagnostics
 					safePublishB("calibrationInProgress", measurement.CalibrationInProgress)
 					safePublishB("buttonPressedOnBoot", measurement.ButtonPressedOnBoot)
 					safePublishB("rtcOnBoot", measurement.RtcOnBoot)
+					safePublishB("macMismatch", measurement.MacMismatch)
+					safePublishI("parseFailures", measurement.ParseFailures)
+					safePublishI("gatewayCount", measurement.GatewayCount)
 				}
 			}
 		}
+		if conf.LWTTopic != "" {
+			// the will is not published on a graceful disconnect
+			payload := conf.LWTOfflinePayload
+			if payload == "" {
+				payload = "{\"state\":\"offline\"}"
+			}
+			client.Publish(conf.LWTTopic, 0, true, payload).WaitTimeout(time.Second)
+		}
+		client.Disconnect(250) // waits for the publishes in progress
+		log.Info().Msg("MQTT sink stopped")
+		close(done)
 	}()
-	return measurements
+	return measurements, done
 }
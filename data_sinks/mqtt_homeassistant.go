@@ -12,22 +12,25 @@ import (
 )
 
 type homeassistantDiscoveryDevice struct {
-	Identifiers  []string `json:"identifiers"`
-	Name         string   `json:"name"`
-	Model        string   `json:"model"`
-	Manufacturer string   `json:"manufacturer"`
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Model         string   `json:"model"`
+	Manufacturer  string   `json:"manufacturer"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
 }
 
 type homeassistantDiscovery struct {
 	UniqueID            string                       `json:"unique_id"`
 	DeviceClass         string                       `json:"device_class,omitempty"`
 	StateTopic          string                       `json:"state_topic"`
-	StateClass          string                       `json:"state_class"`
+	StateClass          string                       `json:"state_class,omitempty"`
 	JsonAttributesTopic string                       `json:"json_attributes_topic"`
 	Name                string                       `json:"name,omitempty"`
-	UnitOfMeasurement   string                       `json:"unit_of_measurement"`
+	UnitOfMeasurement   string                       `json:"unit_of_measurement,omitempty"`
 	ValueTemplate       string                       `json:"value_template"`
 	Icon                string                       `json:"icon,omitempty"`
+	PayloadOn           string                       `json:"payload_on,omitempty"`
+	PayloadOff          string                       `json:"payload_off,omitempty"`
 	AvailabilityTopic   string                       `json:"availability_topic,omitempty"`
 	PayloadAvailable    string                       `json:"payload_available,omitempty"`
 	PayloadNotAvailable string                       `json:"payload_not_available,omitempty"`
@@ -36,18 +39,32 @@ type homeassistantDiscovery struct {
 }
 
 type homeassistantDiscoveryAttributes struct {
-	Mac                       string `json:"mac"`
-	DataFormat                string `json:"data_format"`
-	Rssi                      *int64 `json:"rssi,omitempty"`
-	TxPower                   *int64 `json:"tx_power,omitempty"`
-	MeasurementSequenceNumber *int64 `json:"measurement_sequence_number,omitempty"`
-	CalibrationInProgress     *bool  `json:"calibration_in_progress,omitempty"`
-	ButtonPressedOnBoot       *bool  `json:"button_pressed_on_boot,omitempty"`
-	RtcOnBoot                 *bool  `json:"rtc_on_boot,omitempty"`
+	Mac                       string            `json:"mac"`
+	DataFormat                string            `json:"data_format"`
+	Rssi                      *int64            `json:"rssi,omitempty"`
+	TxPower                   *int64            `json:"tx_power,omitempty"`
+	MeasurementSequenceNumber *int64            `json:"measurement_sequence_number,omitempty"`
+	RandomId                  *int64            `json:"random_id,omitempty"`
+	CalibrationInProgress     *bool             `json:"calibration_in_progress,omitempty"`
+	ButtonPressedOnBoot       *bool             `json:"button_pressed_on_boot,omitempty"`
+	RtcOnBoot                 *bool             `json:"rtc_on_boot,omitempty"`
+	EmbeddedMac               *string           `json:"embedded_mac,omitempty"`
+	GatewayMac                *string           `json:"gateway_mac,omitempty"`
+	SourceType                string            `json:"source_type,omitempty"`
+	SourceName                string            `json:"source_name,omitempty"`
+	MacMismatch               *bool             `json:"mac_mismatch,omitempty"`
+	ParseFailures             *int64            `json:"parse_failures,omitempty"`
+	LocalName                 *string           `json:"local_name,omitempty"`
+	Location                  *string           `json:"location,omitempty"`
+	Room                      *string           `json:"room,omitempty"`
+	Floor                     *string           `json:"floor,omitempty"`
+	Owner                     *string           `json:"owner,omitempty"`
+	Metadata                  map[string]string `json:"metadata,omitempty"`
 }
 
 type homeassistantDiscoveryConfig struct {
 	Available            bool
+	BinarySensor         bool
 	DeviceClass          string
 	EntityName           string
 	UnitOfMeasurement    string
@@ -200,6 +217,15 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		StateClass:        "total_increasing",
 		EntityCategory:    "diagnostic",
 	})
+	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+		Available:         measurement.ContinuousSequenceNumber != nil,
+		EntityName:        "Continuous sequence number",
+		UnitOfMeasurement: "x",
+		JsonAttribute:     "continuousSequenceNumber",
+		Icon:              "mdi:counter",
+		StateClass:        "total_increasing",
+		EntityCategory:    "diagnostic",
+	})
 	// New E1 fields
 	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
 		Available:         measurement.Pm1p0 != nil,
@@ -288,26 +314,87 @@ func publishHomeAssistantDiscoveries(client mqtt.Client, conf config.MQTTPublish
 		EntityName:    "Air quality index",
 		JsonAttribute: "airQualityIndex",
 	})
+	// Third party sensors
+	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+		Available:         measurement.BatteryLevel != nil,
+		DeviceClass:       "battery",
+		EntityName:        "Battery",
+		UnitOfMeasurement: "%",
+		JsonAttribute:     "batteryLevel",
+		EntityCategory:    "diagnostic",
+	})
+	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+		Available:         measurement.Moisture != nil,
+		DeviceClass:       "moisture",
+		EntityName:        "Moisture",
+		UnitOfMeasurement: "%",
+		JsonAttribute:     "moisture",
+	})
+	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+		Available:     measurement.Motion != nil,
+		BinarySensor:  true,
+		DeviceClass:   "motion",
+		EntityName:    "Motion",
+		JsonAttribute: "motion",
+	})
+	publishHomeAssistantDiscovery(client, conf, measurement, homeassistantDiscoveryConfig{
+		Available:     measurement.Opening != nil,
+		BinarySensor:  true,
+		DeviceClass:   "opening",
+		EntityName:    "Opening",
+		JsonAttribute: "opening",
+	})
+}
+
+// homeassistantDevice returns the model and manufacturer of the device sending data in the format of the measurement
+func homeassistantDevice(measurement parser.Measurement) (string, string) {
+	switch measurement.FormatName() {
+	case "BTHome":
+		return "BTHome sensor", "BTHome"
+	case "ATC1441":
+		return "Thermometer (ATC1441 firmware)", "Xiaomi"
+	case "PVVX":
+		return "Thermometer (pvvx firmware)", "Xiaomi"
+	default:
+		return "RuuviTag", "Ruuvi"
+	}
 }
 
 func publishHomeAssistantDiscovery(client mqtt.Client, conf config.MQTTPublisher, measurement parser.Measurement, disco homeassistantDiscoveryConfig) {
 	id := fmt.Sprintf("ruuvitag_%s_%s", strings.ReplaceAll(measurement.Mac, ":", ""), disco.JsonAttribute)
-	confTopicPrefix := fmt.Sprintf("%s/sensor/%s", conf.HomeassistantDiscoveryPrefix, id)
+	component := "sensor"
+	if disco.BinarySensor {
+		component = "binary_sensor"
+	}
+	confTopicPrefix := fmt.Sprintf("%s/%s/%s", conf.HomeassistantDiscoveryPrefix, component, id)
 	if !disco.Available {
 		client.Publish(confTopicPrefix+"/config", 0, conf.RetainMessages, "")
 		client.Publish(confTopicPrefix+"/attributes", 0, conf.RetainMessages, "")
 		return
 	}
+	model, manufacturer := homeassistantDevice(measurement)
 	var name string
 	if measurement.Name != nil {
 		name = *measurement.Name
 	} else {
-		name = fmt.Sprintf("RuuviTag %s", measurement.Mac)
+		name = fmt.Sprintf("%s %s", model, measurement.Mac)
+	}
+	var suggestedArea string // the room, or the location if the room is not configured
+	if measurement.Room != nil {
+		suggestedArea = *measurement.Room
+	} else if measurement.Location != nil {
+		suggestedArea = *measurement.Location
 	}
 	stateClass := disco.StateClass
-	if stateClass == "" {
+	if stateClass == "" && !disco.BinarySensor {
 		stateClass = "measurement"
 	}
+	valueTemplate := fmt.Sprintf("{{ (value_json.%s%s) | round(2) }}", disco.JsonAttribute, disco.JsonAttributeMutator)
+	var payloadOn, payloadOff string
+	if disco.BinarySensor {
+		valueTemplate = fmt.Sprintf("{{ 'ON' if value_json.%s else 'OFF' }}", disco.JsonAttribute)
+		payloadOn, payloadOff = "ON", "OFF"
+	}
 	discoveryJson, err := json.Marshal(homeassistantDiscovery{
 		UniqueID:            id,
 		DeviceClass:         disco.DeviceClass,
@@ -316,17 +403,20 @@ func publishHomeAssistantDiscovery(client mqtt.Client, conf config.MQTTPublisher
 		JsonAttributesTopic: confTopicPrefix + "/attributes",
 		Name:                disco.EntityName,
 		UnitOfMeasurement:   disco.UnitOfMeasurement,
-		ValueTemplate:       fmt.Sprintf("{{ (value_json.%s%s) | round(2) }}", disco.JsonAttribute, disco.JsonAttributeMutator),
+		ValueTemplate:       valueTemplate,
 		Icon:                disco.Icon,
+		PayloadOn:           payloadOn,
+		PayloadOff:          payloadOff,
 		AvailabilityTopic:   conf.LWTTopic,
 		PayloadAvailable:    conf.LWTOnlinePayload,
 		PayloadNotAvailable: conf.LWTOfflinePayload,
 		EntityCategory:      disco.EntityCategory,
 		Device: homeassistantDiscoveryDevice{
-			Identifiers:  []string{measurement.Mac},
-			Name:         name,
-			Model:        "RuuviTag",
-			Manufacturer: "Ruuvi",
+			Identifiers:   []string{measurement.Mac},
+			Name:          name,
+			Model:         model,
+			Manufacturer:  manufacturer,
+			SuggestedArea: suggestedArea,
 		},
 	})
 	if err != nil {
@@ -335,10 +425,23 @@ func publishHomeAssistantDiscovery(client mqtt.Client, conf config.MQTTPublisher
 	}
 	attributesJson, err := json.Marshal(homeassistantDiscoveryAttributes{
 		Mac:                   measurement.Mac,
-		DataFormat:            fmt.Sprintf("%X", measurement.DataFormat),
+		DataFormat:            measurement.FormatName(),
+		RandomId:              measurement.RandomId,
 		CalibrationInProgress: measurement.CalibrationInProgress,
 		ButtonPressedOnBoot:   measurement.ButtonPressedOnBoot,
 		RtcOnBoot:             measurement.RtcOnBoot,
+		EmbeddedMac:           measurement.EmbeddedMac,
+		GatewayMac:            measurement.GatewayMac,
+		SourceType:            measurement.SourceType,
+		SourceName:            measurement.SourceName,
+		MacMismatch:           measurement.MacMismatch,
+		ParseFailures:         measurement.ParseFailures,
+		LocalName:             measurement.LocalName,
+		Location:              measurement.Location,
+		Room:                  measurement.Room,
+		Floor:                 measurement.Floor,
+		Owner:                 measurement.Owner,
+		Metadata:              measurement.Metadata,
 	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to serialize Home Assistant attribute data")
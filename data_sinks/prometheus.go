@@ -1,9 +1,14 @@
 package data_sinks
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
+	"regexp"
 	"runtime"
+	"slices"
 
 	"github.com/Scrin/RuuviBridge/common/version"
 	"github.com/Scrin/RuuviBridge/config"
@@ -13,7 +18,19 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// partialDeleter is a metric vector whose series can be deleted by a subset of their labels
+type partialDeleter interface {
+	DeletePartialMatch(labels prometheus.Labels) int
+}
+
 var metrics struct {
+	sourceLabels   bool
+	metadataLabels []string
+	vecs           []partialDeleter
+	identities     map[string]prometheus.Labels // the name and metadata labels last recorded for each mac
+
 	info         prometheus.Gauge
 	measurements *prometheus.CounterVec
 
@@ -28,6 +45,7 @@ var metrics struct {
 	rssi                      *prometheus.GaugeVec
 	movementCounter           *prometheus.GaugeVec
 	measurementSequenceNumber *prometheus.GaugeVec
+	continuousSequenceNumber  *prometheus.GaugeVec
 
 	accelerationTotal        *prometheus.GaugeVec
 	absoluteHumidity         *prometheus.GaugeVec
@@ -52,15 +70,41 @@ var metrics struct {
 	soundPeak       *prometheus.GaugeVec
 	airQualityIndex *prometheus.GaugeVec
 
+	// Third party sensors
+	batteryLevel *prometheus.GaugeVec
+	moisture     *prometheus.GaugeVec
+	motion       *prometheus.GaugeVec
+	opening      *prometheus.GaugeVec
+
 	// Diagnostics
 	calibrationInProgress *prometheus.GaugeVec
 	buttonPressedOnBoot   *prometheus.GaugeVec
 	rtcOnBoot             *prometheus.GaugeVec
+	macMismatch           *prometheus.GaugeVec
+	parseFailures         *prometheus.GaugeVec
+	gatewayCount          *prometheus.GaugeVec
 }
 
-func initMetrics(measurementMetricPrefix string) {
+// initMetrics creates the measurement metrics in a registry of their own, so that the sink can be restarted with a
+// different config
+func initMetrics(measurementMetricPrefix string, sourceLabels bool, metadataLabels []string) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
 	bridgeMetricPrefix := "ruuvibridge_"
 	tagLabels := []string{"name", "mac", "data_format"}
+	if sourceLabels {
+		tagLabels = append(tagLabels, "gateway_mac", "source_type", "source_name")
+	}
+	tagLabels = append(tagLabels, metadataLabels...)
+	metrics.sourceLabels = sourceLabels
+	metrics.metadataLabels = metadataLabels
+	metrics.vecs = nil
+	metrics.identities = make(map[string]prometheus.Labels)
+	register := func(collector prometheus.Collector) {
+		registry.MustRegister(collector)
+		if vec, ok := collector.(partialDeleter); ok {
+			metrics.vecs = append(metrics.vecs, vec)
+		}
+	}
 
 	metrics.info = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: bridgeMetricPrefix + "info",
@@ -121,6 +165,10 @@ func initMetrics(measurementMetricPrefix string) {
 		Name: measurementMetricPrefix + "measurement_sequence_number",
 		Help: "Measurement sequence number",
 	}, tagLabels)
+	metrics.continuousSequenceNumber = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "continuous_sequence_number",
+		Help: "Measurement sequence number unwrapped into a continuous counter, reset when the tag reboots",
+	}, tagLabels)
 
 	metrics.accelerationTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: measurementMetricPrefix + "acceleration_total",
@@ -205,6 +253,24 @@ func initMetrics(measurementMetricPrefix string) {
 		Help: "Air quality index",
 	}, tagLabels)
 
+	// Third party sensor metrics
+	metrics.batteryLevel = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "battery_level",
+		Help: "Battery level (%)",
+	}, tagLabels)
+	metrics.moisture = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "moisture",
+		Help: "Moisture (%)",
+	}, tagLabels)
+	metrics.motion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "motion",
+		Help: "Motion detected (1/0)",
+	}, tagLabels)
+	metrics.opening = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "opening",
+		Help: "Door or window open (1/0)",
+	}, tagLabels)
+
 	// Diagnostic metrics
 	metrics.calibrationInProgress = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: measurementMetricPrefix + "calibration_in_progress",
@@ -218,51 +284,74 @@ func initMetrics(measurementMetricPrefix string) {
 		Name: measurementMetricPrefix + "rtc_on_boot",
 		Help: "RTC was running at boot (1/0)",
 	}, tagLabels)
+	metrics.macMismatch = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "mac_mismatch",
+		Help: "Embedded MAC address does not match the reported MAC address (1/0)",
+	}, tagLabels)
+	metrics.parseFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "parse_failures",
+		Help: "Number of packets from the tag that failed to parse since the tag was first parsed successfully",
+	}, tagLabels)
+	metrics.gatewayCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: measurementMetricPrefix + "gateway_count",
+		Help: "Number of gateways that received the packet, when deduplication is enabled",
+	}, tagLabels)
+
+	register(metrics.info)
+	register(metrics.measurements)
 
-	prometheus.MustRegister(metrics.info)
-	prometheus.MustRegister(metrics.measurements)
-
-	prometheus.MustRegister(metrics.temperature)
-	prometheus.MustRegister(metrics.humidity)
-	prometheus.MustRegister(metrics.pressure)
-	prometheus.MustRegister(metrics.accelerationX)
-	prometheus.MustRegister(metrics.accelerationY)
-	prometheus.MustRegister(metrics.accelerationZ)
-	prometheus.MustRegister(metrics.batteryVoltage)
-	prometheus.MustRegister(metrics.txPower)
-	prometheus.MustRegister(metrics.rssi)
-	prometheus.MustRegister(metrics.movementCounter)
-	prometheus.MustRegister(metrics.measurementSequenceNumber)
-
-	prometheus.MustRegister(metrics.accelerationTotal)
-	prometheus.MustRegister(metrics.absoluteHumidity)
-	prometheus.MustRegister(metrics.dewPoint)
-	prometheus.MustRegister(metrics.equilibriumVaporPressure)
-	prometheus.MustRegister(metrics.airDensity)
-	prometheus.MustRegister(metrics.accelerationAngleFromX)
-	prometheus.MustRegister(metrics.accelerationAngleFromY)
-	prometheus.MustRegister(metrics.accelerationAngleFromZ)
+	register(metrics.temperature)
+	register(metrics.humidity)
+	register(metrics.pressure)
+	register(metrics.accelerationX)
+	register(metrics.accelerationY)
+	register(metrics.accelerationZ)
+	register(metrics.batteryVoltage)
+	register(metrics.txPower)
+	register(metrics.rssi)
+	register(metrics.movementCounter)
+	register(metrics.measurementSequenceNumber)
+	register(metrics.continuousSequenceNumber)
+
+	register(metrics.accelerationTotal)
+	register(metrics.absoluteHumidity)
+	register(metrics.dewPoint)
+	register(metrics.equilibriumVaporPressure)
+	register(metrics.airDensity)
+	register(metrics.accelerationAngleFromX)
+	register(metrics.accelerationAngleFromY)
+	register(metrics.accelerationAngleFromZ)
 
 	// Register new E1 metrics
-	prometheus.MustRegister(metrics.pm1p0)
-	prometheus.MustRegister(metrics.pm2p5)
-	prometheus.MustRegister(metrics.pm4p0)
-	prometheus.MustRegister(metrics.pm10p0)
-	prometheus.MustRegister(metrics.co2)
-	prometheus.MustRegister(metrics.voc)
-	prometheus.MustRegister(metrics.nox)
-	prometheus.MustRegister(metrics.luminosity)
-	prometheus.MustRegister(metrics.soundInstant)
-	prometheus.MustRegister(metrics.soundAverage)
-	prometheus.MustRegister(metrics.soundPeak)
-	prometheus.MustRegister(metrics.airQualityIndex)
+	register(metrics.pm1p0)
+	register(metrics.pm2p5)
+	register(metrics.pm4p0)
+	register(metrics.pm10p0)
+	register(metrics.co2)
+	register(metrics.voc)
+	register(metrics.nox)
+	register(metrics.luminosity)
+	register(metrics.soundInstant)
+	register(metrics.soundAverage)
+	register(metrics.soundPeak)
+	register(metrics.airQualityIndex)
+
+	// Register third party sensors
+	register(metrics.batteryLevel)
+	register(metrics.moisture)
+	register(metrics.motion)
+	register(metrics.opening)
 
 	// Register diagnostics
-	prometheus.MustRegister(metrics.calibrationInProgress)
-	prometheus.MustRegister(metrics.buttonPressedOnBoot)
-	prometheus.MustRegister(metrics.rtcOnBoot)
+	register(metrics.calibrationInProgress)
+	register(metrics.buttonPressedOnBoot)
+	register(metrics.rtcOnBoot)
+	register(metrics.macMismatch)
+	register(metrics.parseFailures)
+	register(metrics.gatewayCount)
 
 	metrics.info.Set(1)
+	return registry
 }
 
 func recordMetrics(m parser.Measurement) {
@@ -270,7 +359,34 @@ func recordMetrics(m parser.Measurement) {
 	if m.Name != nil {
 		name = *m.Name
 	}
-	labels := prometheus.Labels{"name": name, "mac": m.Mac, "data_format": fmt.Sprintf("%X", m.DataFormat)}
+	labels := prometheus.Labels{"name": name, "mac": m.Mac, "data_format": m.FormatName()}
+	if metrics.sourceLabels {
+		gatewayMac := ""
+		if m.GatewayMac != nil {
+			gatewayMac = *m.GatewayMac
+		}
+		labels["gateway_mac"] = gatewayMac
+		labels["source_type"] = m.SourceType
+		labels["source_name"] = m.SourceName
+	}
+	identity := prometheus.Labels{"name": name, "mac": m.Mac}
+	if len(metrics.metadataLabels) > 0 {
+		metadata := m.TagMetadata()
+		for _, label := range metrics.metadataLabels {
+			labels[label] = metadata[label]
+			identity[label] = metadata[label]
+		}
+	}
+	// the name and metadata of a tag change when the config is reloaded, the series with the old labels are deleted so
+	// that they do not show up as duplicates of the tag
+	if previous, ok := metrics.identities[m.Mac]; !ok || !maps.Equal(previous, identity) {
+		if ok {
+			for _, vec := range metrics.vecs {
+				vec.DeletePartialMatch(previous)
+			}
+		}
+		metrics.identities[m.Mac] = identity
+	}
 	safeSetF := func(gauge *prometheus.GaugeVec, v *float64) {
 		if v != nil {
 			gauge.With(labels).Set(*v)
@@ -304,6 +420,7 @@ func recordMetrics(m parser.Measurement) {
 	safeSetI(metrics.rssi, m.Rssi)
 	safeSetI(metrics.movementCounter, m.MovementCounter)
 	safeSetI(metrics.measurementSequenceNumber, m.MeasurementSequenceNumber)
+	safeSetI(metrics.continuousSequenceNumber, m.ContinuousSequenceNumber)
 
 	safeSetF(metrics.accelerationTotal, m.AccelerationTotal)
 	safeSetF(metrics.absoluteHumidity, m.AbsoluteHumidity)
@@ -328,31 +445,67 @@ func recordMetrics(m parser.Measurement) {
 	safeSetF(metrics.soundPeak, m.SoundPeak)
 	safeSetF(metrics.airQualityIndex, m.AirQualityIndex)
 
+	// Third party sensors
+	safeSetF(metrics.batteryLevel, m.BatteryLevel)
+	safeSetF(metrics.moisture, m.Moisture)
+	safeSetB(metrics.motion, m.Motion)
+	safeSetB(metrics.opening, m.Opening)
+
 	// Diagnostics
 	safeSetB(metrics.calibrationInProgress, m.CalibrationInProgress)
 	safeSetB(metrics.buttonPressedOnBoot, m.ButtonPressedOnBoot)
 	safeSetB(metrics.rtcOnBoot, m.RtcOnBoot)
+	safeSetB(metrics.macMismatch, m.MacMismatch)
+	safeSetI(metrics.parseFailures, m.ParseFailures)
+	safeSetI(metrics.gatewayCount, m.GatewayCount)
+}
+
+// ValidatePrometheus checks the prometheus config without starting the sink
+func ValidatePrometheus(conf config.Prometheus) error {
+	reservedLabels := []string{"name", "mac", "data_format", "gateway_mac", "source_type", "source_name"}
+	for i, label := range conf.MetadataLabels {
+		if !labelNamePattern.MatchString(label) || slices.Contains(reservedLabels, label) || slices.Contains(conf.MetadataLabels[:i], label) {
+			return fmt.Errorf("invalid or duplicate label in metadata_labels: %q", label)
+		}
+	}
+	return nil
 }
 
-func Prometheus(conf config.Prometheus) chan<- parser.Measurement {
+// Prometheus starts the prometheus sink, the config must have been validated with ValidatePrometheus. Returns an error
+// if the port cannot be listened on
+func Prometheus(conf config.Prometheus) (chan<- parser.Measurement, <-chan struct{}, error) {
 	port := conf.Port
 	if port == 0 {
 		port = 8081
 	}
 	log.Info().Int("port", port).Msg("Starting prometheus sink")
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
 	measurements := make(chan parser.Measurement, 1024)
 	measurementMetricPrefix := "ruuvi_"
 	if conf.MeasurementMetricPrefix != "" {
 		measurementMetricPrefix = fmt.Sprintf("%s_", conf.MeasurementMetricPrefix)
 	}
-	initMetrics(measurementMetricPrefix)
+	registry := initMetrics(measurementMetricPrefix, conf.SourceLabels, conf.MetadataLabels)
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry} // the bridge metrics are in the default registry
+	handler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: handler}
+	done := make(chan struct{})
 	go func() {
 		for measurement := range measurements {
 			recordMetrics(measurement)
 		}
+		server.Close()
+		close(done)
 	}()
 
-	go http.ListenAndServe(fmt.Sprintf(":%d", port), promhttp.Handler())
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Int("port", port).Msg("Prometheus server failed")
+		}
+	}()
 
-	return measurements
+	return measurements, done, nil
 }
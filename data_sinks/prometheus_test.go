@@ -0,0 +1,75 @@
+package data_sinks
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPrometheus_PortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if _, _, err := Prometheus(config.Prometheus{Port: port}); err == nil {
+		t.Errorf("expected an error when the port is already in use")
+	}
+}
+
+// temperatures returns the temperature series in the registry by their name label
+func temperatures(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "ruuvi_temperature" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "name" {
+					series[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return series
+}
+
+func TestRecordMetrics_TagRenamed(t *testing.T) {
+	registry := initMetrics("ruuvi_", false, []string{"room"})
+
+	temperature := 21.5
+	oldName, newName := "Sauna", "Kitchen"
+	room := "Downstairs"
+	m := parser.Measurement{}
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.DataFormat = 5
+	m.Temperature = &temperature
+	m.Name = &oldName
+	m.Room = &room
+	recordMetrics(m)
+
+	m.Name = &newName
+	recordMetrics(m)
+	if series := temperatures(t, registry); len(series) != 1 || series[newName] != temperature {
+		t.Errorf("expected only the series with the new name, got %v", series)
+	}
+
+	other := parser.Measurement{}
+	other.Mac = "11:22:33:44:55:66"
+	other.DataFormat = 5
+	other.Temperature = &temperature
+	recordMetrics(other)
+	if series := temperatures(t, registry); len(series) != 2 {
+		t.Errorf("expected the series of other tags to be kept, got %v", series)
+	}
+}
@@ -0,0 +1,317 @@
+package data_sources
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// advertisingReport is a single LE advertising report extracted from the BlueZ tooling output
+type advertisingReport struct {
+	mac  string
+	rssi int64
+	data []byte // AD structures of the advertisement
+}
+
+// recordedReport is an advertising report as recorded by the recorder
+type recordedReport struct {
+	Mac  string `json:"mac"`
+	Rssi int64  `json:"rssi"`
+	Data string `json:"data"`
+}
+
+// handleAdvertisingReport parses the advertising report, using the time it was received as the timestamp
+func handleAdvertisingReport(source source, report advertisingReport, measurements chan<- parser.Measurement) {
+	measurement, ok := source.parse(report.mac, "", strings.ToUpper(hex.EncodeToString(report.data)))
+	if ok {
+		timestamp := *measurement.ReceiveTime / 1000
+		measurement.Rssi = &report.rssi
+		measurement.Timestamp = &timestamp
+		measurements <- measurement
+	}
+}
+
+// stdinReports returns the reports read from stdin. Stdin is read only once, so that the source can be restarted
+var stdinReports = sync.OnceValue(func() <-chan advertisingReport {
+	reports := make(chan advertisingReport)
+	go func() {
+		readBluezLog(os.Stdin, log.With().Str("file", "-").Logger(), func(report advertisingReport) {
+			reports <- report
+		})
+		close(reports)
+	}()
+	return reports
+})
+
+// ValidateBluezLog checks the bluez_log config without starting the reader. A named pipe is not opened, as opening
+// it blocks until there is a writer
+func ValidateBluezLog(conf config.BluezLog) error {
+	if conf.File == "" || conf.File == "-" {
+		return nil
+	}
+	if _, err := os.Stat(conf.File); err != nil {
+		return fmt.Errorf("failed to open the BlueZ log: %w", err)
+	}
+	return nil
+}
+
+func StartBluezLog(ctx context.Context, conf config.BluezLog, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+	file := conf.File
+	if file == "" {
+		file = "-"
+	}
+	name := conf.Name
+	if name == "" {
+		name = file
+		if file == "-" {
+			name = "stdin"
+		}
+	}
+	logger := log.With().
+		Str("file", file).
+		Logger()
+	logger.Info().Msg("Starting BlueZ log reader")
+
+	source := source{typ: "bluez_log", name: name}
+	handle := func(report advertisingReport) {
+		if payload, err := json.Marshal(recordedReport{Mac: report.mac, Rssi: report.rssi, Data: hex.EncodeToString(report.data)}); err == nil {
+			record(source, "", "", payload)
+		}
+		handleAdvertisingReport(source, report, measurements)
+	}
+	done := make(chan struct{})
+
+	if file == "-" {
+		go func() {
+			defer close(done)
+			reports := stdinReports()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case report, ok := <-reports:
+					if !ok {
+						logger.Info().Msg("BlueZ log ended")
+						return
+					}
+					handle(report)
+				}
+			}
+		}()
+		return done, nil
+	}
+
+	go func() {
+		defer close(done)
+		opening := make(chan struct{})
+		go func() {
+			select {
+			case <-opening:
+			case <-ctx.Done():
+				// opening a named pipe blocks until there is a writer, so the pipe is opened for writing to release it
+				if info, err := os.Stat(file); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+					if w, err := os.OpenFile(file, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+						w.Close()
+					}
+				}
+			}
+		}()
+		f, err := os.Open(file)
+		close(opening)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to open the BlueZ log")
+			return
+		}
+		defer f.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		stop := context.AfterFunc(ctx, func() { f.Close() }) // stops the reader
+		defer stop()
+		readBluezLog(f, logger, handle)
+		if ctx.Err() == nil {
+			logger.Info().Msg("BlueZ log ended")
+		}
+	}()
+	return done, nil
+}
+
+// readBluezLog reads the output of btmon or hcidump --raw, calling handle for each LE advertising report. Each packet
+// starts with a line beginning with the direction of the packet (such as "> "), followed by indented lines
+func readBluezLog(r io.Reader, logger zerolog.Logger, handle func(report advertisingReport)) {
+	scanner := bufio.NewScanner(r)
+	var packet []string
+	flush := func() {
+		if len(packet) == 0 {
+			return
+		}
+		var reports []advertisingReport
+		var err error
+		if strings.HasPrefix(packet[0], "> HCI Event:") {
+			reports = parseBtmonPacket(packet)
+		} else if raw, hexErr := hex.DecodeString(strings.Join(strings.Fields(strings.Join(packet, " ")[1:]), "")); hexErr == nil {
+			reports, err = parseHCIEvent(raw)
+		}
+		if err != nil {
+			logger.Debug().Strs("packet", packet).Err(err).Msg("Failed to parse HCI event")
+		}
+		for _, report := range reports {
+			handle(report)
+		}
+		packet = packet[:0]
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(packet) > 0 {
+				packet = append(packet, line)
+			}
+			continue
+		}
+		flush()
+		if strings.HasPrefix(line, "> ") {
+			packet = append(packet, line)
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) { // closed when stopped
+		logger.Error().Err(err).Msg("Failed to read the BlueZ log")
+	}
+}
+
+// parseHCIEvent parses LE advertising reports from a raw HCI event packet, as printed by hcidump --raw
+func parseHCIEvent(raw []byte) ([]advertisingReport, error) {
+	// packet type (event), event code (LE meta event), parameter length, subevent code, number of reports
+	if len(raw) < 5 || raw[0] != 0x04 || raw[1] != 0x3e {
+		return nil, nil
+	}
+	subevent := raw[3]
+	count := int(raw[4])
+	data := raw[5:]
+	var reports []advertisingReport
+	for range count { // the reports follow one after another, as read by the Linux kernel
+		var report advertisingReport
+		var addr, ad []byte
+		switch subevent {
+		case 0x02: // LE advertising report
+			// event type, address type, address, data length, data, rssi
+			if len(data) < 9 || len(data) < 9+int(data[8])+1 {
+				return reports, fmt.Errorf("advertising report is too short")
+			}
+			addr = data[2:8]
+			ad = data[9 : 9+int(data[8])]
+			report.rssi = int64(int8(data[9+len(ad)]))
+			data = data[9+len(ad)+1:]
+		case 0x0d: // LE extended advertising report
+			// event type (2), address type, address, primary phy, secondary phy, sid, tx power, rssi,
+			// periodic advertising interval (2), direct address type, direct address, data length, data
+			if len(data) < 24 || len(data) < 24+int(data[23]) {
+				return reports, fmt.Errorf("extended advertising report is too short")
+			}
+			addr = data[3:9]
+			report.rssi = int64(int8(data[13]))
+			ad = data[24 : 24+int(data[23])]
+			data = data[24+len(ad):]
+		default:
+			return nil, nil
+		}
+		report.mac = fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", addr[5], addr[4], addr[3], addr[2], addr[1], addr[0])
+		report.data = ad
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// parseBtmonPacket parses LE advertising reports from a packet decoded by btmon. As btmon does not print the raw
+// advertisement data, the AD structures are reconstructed from the decoded fields that are relevant for the parser
+func parseBtmonPacket(packet []string) []advertisingReport {
+	var reports []advertisingReport
+	var report *advertisingReport
+	inData := false // the AD structures are printed after the data length, other fields are properties of the report
+	var pending []byte
+	for _, line := range packet[1:] {
+		line = strings.TrimSpace(line)
+		key, value, _ := strings.Cut(line, ": ")
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		if key == "Address" {
+			reports = append(reports, advertisingReport{mac: strings.ToUpper(fields[0])})
+			report = &reports[len(reports)-1]
+			inData = false
+			pending = nil
+			continue
+		}
+		if report == nil {
+			continue
+		}
+		switch {
+		case key == "RSSI":
+			rssi, err := strconv.ParseInt(fields[0], 10, 64)
+			if err == nil {
+				report.rssi = rssi
+			}
+		case key == "Data length":
+			inData = true
+		case !inData:
+		case key == "Flags":
+			if flags, err := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 8); err == nil {
+				report.data = append(report.data, 0x02, 0x01, byte(flags))
+			}
+		case key == "Name (complete)" || key == "Name (short)":
+			adType := byte(0x09)
+			if key == "Name (short)" {
+				adType = 0x08
+			}
+			report.data = append(report.data, byte(len(value)+1), adType)
+			report.data = append(report.data, value...)
+		case key == "TX power":
+			if txPower, err := strconv.ParseInt(fields[0], 10, 8); err == nil {
+				report.data = append(report.data, 0x02, 0x0a, byte(txPower))
+			}
+		case key == "Company" || key == "Service Data":
+			// followed by the data on the next line, the id is in parentheses at the end, in decimal for companies
+			pending = nil
+			start := strings.LastIndex(value, "(")
+			if start < 0 || !strings.HasSuffix(value, ")") {
+				continue
+			}
+			parsed, err := strconv.ParseUint(value[start+1:len(value)-1], 0, 16)
+			if err != nil {
+				continue
+			}
+			adType := byte(0xff)
+			if key == "Service Data" {
+				adType = 0x16
+			}
+			pending = []byte{adType, byte(parsed), byte(parsed >> 8)}
+		case key == "Data" && pending != nil:
+			data, err := hex.DecodeString(value)
+			if err == nil {
+				report.data = append(report.data, byte(len(pending)+len(data)))
+				report.data = append(report.data, pending...)
+				report.data = append(report.data, data...)
+			}
+			pending = nil
+		}
+	}
+	return reports
+}
@@ -0,0 +1,154 @@
+package data_sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+)
+
+func readBluezLogFixture(t *testing.T, name string) []advertisingReport {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var reports []advertisingReport
+	readBluezLog(f, zerolog.Nop(), func(report advertisingReport) {
+		reports = append(reports, report)
+	})
+	return reports
+}
+
+func TestReadBluezLog_Hcidump(t *testing.T) {
+	reports := readBluezLogFixture(t, "hcidump.log")
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 advertising reports, got %d", len(reports))
+	}
+
+	if reports[0].mac != "CB:B8:33:4C:88:4F" || reports[0].rssi != -61 {
+		t.Errorf("legacy report: got mac %s rssi %d", reports[0].mac, reports[0].rssi)
+	}
+	if data := strings.ToUpper(hex.EncodeToString(reports[0].data)); data != testFormat5Data {
+		t.Errorf("legacy report data: got %s want %s", data, testFormat5Data)
+	}
+
+	if reports[1].mac != "CB:B8:33:4C:88:4F" || reports[1].rssi != -75 {
+		t.Errorf("extended report: got mac %s rssi %d", reports[1].mac, reports[1].rssi)
+	}
+	m, err := parser.DecodeBytes(reports[1].data)
+	if err != nil {
+		t.Fatalf("extended report data failed to parse: %v", err)
+	}
+	if m.DataFormat != 0xE1 {
+		t.Errorf("extended report DataFormat: got %X want E1", m.DataFormat)
+	}
+}
+
+func TestParseHCIEvent_MultipleReports(t *testing.T) {
+	// two legacy reports one after another: event type, address type, address, data length, data, rssi
+	event := []byte{0x04, 0x3e, 0x1e, 0x02, 0x02,
+		0x00, 0x01, 0x4f, 0x88, 0x4c, 0x33, 0xb8, 0xcb, 0x03, 0x02, 0x01, 0x06, 0xc3,
+		0x00, 0x00, 0x22, 0x11, 0x00, 0x38, 0xc1, 0xa4, 0x04, 0x03, 0x09, 0x41, 0x42, 0xb0,
+	}
+	reports, err := parseHCIEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 advertising reports, got %d", len(reports))
+	}
+	if reports[0].mac != "CB:B8:33:4C:88:4F" || reports[0].rssi != -61 || hex.EncodeToString(reports[0].data) != "020106" {
+		t.Errorf("first report: got mac %s rssi %d data %X", reports[0].mac, reports[0].rssi, reports[0].data)
+	}
+	if reports[1].mac != "A4:C1:38:00:11:22" || reports[1].rssi != -80 || hex.EncodeToString(reports[1].data) != "03094142" {
+		t.Errorf("second report: got mac %s rssi %d data %X", reports[1].mac, reports[1].rssi, reports[1].data)
+	}
+}
+
+func TestReadBluezLog_Btmon(t *testing.T) {
+	reports := readBluezLogFixture(t, "btmon.log")
+	if len(reports) != 3 {
+		t.Fatalf("expected 3 advertising reports, got %d", len(reports))
+	}
+
+	if reports[0].mac != "CB:B8:33:4C:88:4F" || reports[0].rssi != -61 {
+		t.Errorf("ruuvi report: got mac %s rssi %d", reports[0].mac, reports[0].rssi)
+	}
+	if data := strings.ToUpper(hex.EncodeToString(reports[0].data)); data != testFormat5Data {
+		t.Errorf("ruuvi report data: got %s want %s", data, testFormat5Data)
+	}
+
+	if reports[1].mac != "A4:C1:38:00:11:22" || reports[1].rssi != -80 {
+		t.Errorf("bthome report: got mac %s rssi %d", reports[1].mac, reports[1].rssi)
+	}
+	m, err := parser.DecodeBytes(reports[1].data)
+	if err != nil {
+		t.Fatalf("bthome report data failed to parse: %v", err)
+	}
+	if m.FormatName() != "BTHome" || m.Temperature == nil || *m.Temperature != 25.06 {
+		t.Errorf("bthome report: got format %s temperature %v", m.FormatName(), m.Temperature)
+	}
+	if m.LocalName == nil || *m.LocalName != "ATC_001122" {
+		t.Errorf("bthome report LocalName: got %v", m.LocalName)
+	}
+}
+
+func TestStartBluezLog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	measurements := make(chan parser.Measurement, 10)
+	done, err := StartBluezLog(ctx, config.BluezLog{File: "testdata/hcidump.log"}, measurements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done // the source stops at the end of the file
+	cancel()
+	if len(measurements) != 2 {
+		t.Fatalf("expected 2 measurements, got %d", len(measurements))
+	}
+	for i := 0; i < 2; i++ {
+		m := <-measurements
+		if m.Mac != "CB:B8:33:4C:88:4F" || m.SourceType != "bluez_log" || m.SourceName != "testdata/hcidump.log" {
+			t.Errorf("measurement %d: got mac %s source %s/%s", i, m.Mac, m.SourceType, m.SourceName)
+		}
+		if m.Rssi == nil || m.Timestamp == nil {
+			t.Errorf("measurement %d: expected rssi and timestamp", i)
+		}
+	}
+}
+
+func TestStartBluezLog_Record(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "recording.jsonl")
+	r, err := newTrafficRecorder(file, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Store(r)
+	done, err := StartBluezLog(context.Background(), config.BluezLog{File: "testdata/hcidump.log"}, make(chan parser.Measurement, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	recorder.Store(nil)
+	r.close()
+
+	recording, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurements := make(chan parser.Measurement, 10)
+	replay(context.Background(), bytes.NewReader(recording), 0, measurements, zerolog.Nop())
+	if len(measurements) != 2 {
+		t.Fatalf("expected the 2 recorded reports to be replayed, got %d", len(measurements))
+	}
+	if m := <-measurements; m.Mac != "CB:B8:33:4C:88:4F" || m.SourceType != "replay" || m.Rssi == nil {
+		t.Errorf("unexpected replayed measurement %+v", m)
+	}
+}
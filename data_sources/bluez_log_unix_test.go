@@ -0,0 +1,38 @@
+//go:build unix
+
+package data_sources
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func TestStartBluezLog_StopWhileOpeningPipe(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "btmon")
+	if err := syscall.Mkfifo(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := StartBluezLog(ctx, config.BluezLog{File: file}, make(chan parser.Measurement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond) // let the reader block on opening the pipe
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the reader to stop while waiting for a writer")
+	}
+	if w, err := os.OpenFile(file, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		w.Close()
+		t.Errorf("expected the pipe to have no reader left after stopping")
+	}
+}
@@ -1,12 +1,16 @@
 package data_sources
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Scrin/RuuviBridge/common/metrics"
 	"github.com/Scrin/RuuviBridge/config"
 	"github.com/Scrin/RuuviBridge/parser"
 	"github.com/rs/zerolog"
@@ -31,39 +35,101 @@ type gatewayHistory struct {
 	} `json:"data"`
 }
 
-func StartGatewayPolling(conf config.GatewayPolling, measurements chan<- parser.Measurement) chan<- bool {
-	interval := conf.Interval
-	if interval == 0 {
-		interval = 10 * time.Second
+// gatewayPollingTargets returns the polled gateways, including the one configured directly in the section
+func gatewayPollingTargets(conf config.GatewayPolling) []config.GatewayPollingTarget {
+	gateways := conf.Gateways
+	if conf.GatewayUrl != "" {
+		gateways = append([]config.GatewayPollingTarget{{
+			Name:        conf.Name,
+			GatewayUrl:  conf.GatewayUrl,
+			BearerToken: conf.BearerToken,
+			Interval:    conf.Interval,
+		}}, gateways...)
 	}
-	logger := log.With().
-		Str("target", conf.GatewayUrl).
-		Dur("interval", interval).
-		Logger()
-	logger.Info().Msg("Starting gateway polling")
-	stop := make(chan bool)
-	go gatewayPoller(conf.GatewayUrl, conf.BearerToken, interval, measurements, stop, logger)
-	return stop
+	return gateways
 }
 
-func gatewayPoller(url string, bearer_token string, interval time.Duration, measurements chan<- parser.Measurement, stop <-chan bool, logger zerolog.Logger) {
+// ValidateGatewayPolling checks the gateway_polling config without starting the polling
+func ValidateGatewayPolling(conf config.GatewayPolling) error {
+	if len(gatewayPollingTargets(conf)) == 0 {
+		return errors.New("gateway_polling enabled but no gateways configured")
+	}
+	return nil
+}
+
+func StartGatewayPolling(ctx context.Context, conf config.GatewayPolling, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+	if err := ValidateGatewayPolling(conf); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	for _, gateway := range gatewayPollingTargets(conf) {
+		interval := gateway.Interval
+		if interval == 0 {
+			interval = conf.Interval
+		}
+		if interval == 0 {
+			interval = 10 * time.Second
+		}
+		bearerToken := gateway.BearerToken
+		if bearerToken == "" {
+			bearerToken = conf.BearerToken
+		}
+		name := gateway.Name
+		if name == "" {
+			name = gateway.GatewayUrl
+		}
+		logger := log.With().
+			Str("target", gateway.GatewayUrl).
+			Str("name", name).
+			Dur("interval", interval).
+			Logger()
+		logger.Info().Msg("Starting gateway polling")
+		source := source{typ: "gateway_polling", name: name}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gatewayPoller(ctx, source, gateway.GatewayUrl, bearerToken, interval, measurements, logger)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done, nil
+}
+
+// gatewayPoller polls a single gateway until stopped, with its own state of seen tags
+func gatewayPoller(ctx context.Context, source source, url string, bearer_token string, interval time.Duration, measurements chan<- parser.Measurement, logger zerolog.Logger) {
 	seenTags := make(map[string]int64)
-	poll(url, bearer_token, measurements, seenTags, logger)
+	pollAndCount := func() {
+		result := "error"
+		if poll(ctx, source, url, bearer_token, measurements, seenTags, logger) {
+			result = "success"
+		} else if ctx.Err() != nil {
+			return // stopping, the poll was cancelled
+		}
+		metrics.GatewayPolls.WithLabelValues(source.name, result).Inc()
+	}
+	pollAndCount()
 	for {
 		select {
-		case <-stop:
+		case <-ctx.Done():
 			return
 		case <-time.After(interval):
-			poll(url, bearer_token, measurements, seenTags, logger)
+			pollAndCount()
 		}
 	}
 }
 
-func poll(url string, bearer_token string, measurements chan<- parser.Measurement, seenTags map[string]int64, logger zerolog.Logger) {
-	req, err := http.NewRequest("GET", url+"/history", nil)
+// poll fetches the history from the gateway, returning whether the poll succeeded. A poll cancelled by stopping the
+// source is not logged as an error
+func poll(ctx context.Context, source source, url string, bearer_token string, measurements chan<- parser.Measurement, seenTags map[string]int64, logger zerolog.Logger) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", url+"/history", nil)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to construct GET request")
-		return
+		return false
 	}
 
 	if bearer_token != "" {
@@ -73,34 +139,44 @@ func poll(url string, bearer_token string, measurements chan<- parser.Measuremen
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return false // stopping, the poll was cancelled
+		}
 		logger.Error().Err(err).Msg("Failed to get history from gateway")
-		return
+		return false
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to read data from gateway")
-		return
+		return false
 	}
+	record(source, "", "/history", body)
 
 	var gatewayInfo gatewayInfo
 	err = json.Unmarshal(body, &gatewayInfo)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to deserialize gateway data")
-		return
+		return false
 	}
 	if len(gatewayInfo.GatewayName) > 0 {
 		logger.Error().Msg("Failed to authenticate")
-		return
+		return false
 	}
 
 	var gatewayHistory gatewayHistory
 	err = json.Unmarshal(body, &gatewayHistory)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to deserialize gateway data")
-		return
+		return false
 	}
 
+	handleGatewayHistory(source, gatewayHistory, seenTags, measurements)
+	return true
+}
+
+// handleGatewayHistory parses the tags of the gateway history that have not been seen with the same timestamp yet
+func handleGatewayHistory(source source, gatewayHistory gatewayHistory, seenTags map[string]int64, measurements chan<- parser.Measurement) {
 	for mac, data := range gatewayHistory.Data.Tags {
 		mac = strings.ToUpper(mac)
 		timestamp := data.Timestamp
@@ -108,9 +184,8 @@ func poll(url string, bearer_token string, measurements chan<- parser.Measuremen
 			continue
 		}
 		seenTags[mac] = timestamp
-		measurement, ok := parser.Parse(data.Data)
+		measurement, ok := source.parse(mac, gatewayHistory.Data.GwMac, data.Data)
 		if ok {
-			measurement.Mac = mac
 			measurement.Rssi = &data.Rssi
 			measurement.Timestamp = &timestamp
 			measurements <- measurement
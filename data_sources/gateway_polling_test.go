@@ -0,0 +1,113 @@
+package data_sources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatewayPolls returns the number of polls of the gateway counted by the result
+func gatewayPolls(t *testing.T, gateway string) map[string]float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	polls := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "ruuvibridge_gateway_polls_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["gateway"] == gateway {
+				polls[labels["result"]] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return polls
+}
+
+func TestStartGatewayPolling_MultipleGateways(t *testing.T) {
+	gateway := func(gwMac string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// both gateways report the same tag with the same timestamp
+			fmt.Fprintf(w, `{"data":{"gw_mac":"%s","tags":{"cb:b8:33:4c:88:4f":{"rssi":-70,"timestamp":1704110401,"data":"%s"}}}}`, gwMac, testFormat5Data)
+		}))
+	}
+	first := gateway("c8:25:2d:8e:9c:01")
+	defer first.Close()
+	second := gateway("c8:25:2d:8e:9c:02")
+	defer second.Close()
+
+	before := map[string]float64{"first": gatewayPolls(t, "first")["success"], "second": gatewayPolls(t, "second")["success"]}
+	ctx, cancel := context.WithCancel(context.Background())
+	measurements := make(chan parser.Measurement, 10)
+	done, err := StartGatewayPolling(ctx, config.GatewayPolling{
+		Interval: time.Hour,
+		Gateways: []config.GatewayPollingTarget{
+			{Name: "first", GatewayUrl: first.URL},
+			{Name: "second", GatewayUrl: second.URL},
+		},
+	}, measurements)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(map[string]parser.Measurement)
+	for range 2 {
+		select {
+		case m := <-measurements:
+			received[m.SourceName] = m
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected a measurement from each gateway, got %d", len(received))
+		}
+	}
+	cancel()
+	<-done
+
+	for name, gwMac := range map[string]string{"first": "C8:25:2D:8E:9C:01", "second": "C8:25:2D:8E:9C:02"} {
+		m, ok := received[name]
+		if !ok {
+			t.Errorf("expected the tag seen by %s not to be skipped as seen by the other gateway", name)
+			continue
+		}
+		if m.GatewayMac == nil || *m.GatewayMac != gwMac || m.Mac != "CB:B8:33:4C:88:4F" {
+			t.Errorf("%s: got mac %s gateway mac %v", name, m.Mac, m.GatewayMac)
+		}
+		if polls := gatewayPolls(t, name); polls["success"]-before[name] != 1 {
+			t.Errorf("%s: expected a successful poll, got %v", name, polls)
+		}
+	}
+}
+
+func TestStartGatewayPolling_Cancelled(t *testing.T) {
+	requested := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done() // never responds
+	}))
+	defer gateway.Close()
+
+	before := gatewayPolls(t, "cancelled")
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := StartGatewayPolling(ctx, config.GatewayPolling{Name: "cancelled", GatewayUrl: gateway.URL}, make(chan parser.Measurement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-requested
+	cancel()
+	<-done
+	if polls := gatewayPolls(t, "cancelled"); polls["success"] != before["success"] || polls["error"] != before["error"] {
+		t.Errorf("expected the cancelled poll not to be counted, got %v", polls)
+	}
+}
@@ -1,33 +1,128 @@
 package data_sources
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/Scrin/RuuviBridge/config"
 	"github.com/Scrin/RuuviBridge/parser"
 	"github.com/rs/zerolog/log"
 )
 
-func StartHTTPListener(conf config.HTTPListener, measurements chan<- parser.Measurement) chan<- bool {
+// ValidateHTTPListener checks the http_listener config without listening. The TLS certificate must load, while the
+// bind address is left for the listening to check
+func ValidateHTTPListener(conf config.HTTPListener) error {
+	if conf.TLSCertFile != "" || conf.TLSKeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile); err != nil {
+			return fmt.Errorf("failed to load the TLS certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// httpListenerShutdownTimeout is how long stopping the http listener waits for the requests in progress
+const httpListenerShutdownTimeout = 5 * time.Second
+
+func StartHTTPListener(ctx context.Context, conf config.HTTPListener, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
 	port := conf.Port
 	if port == 0 {
 		port = 8080
 	}
-	log.Info().Int("port", port).Msg("Starting http listener")
+	address := fmt.Sprintf("%s:%d", conf.BindAddress, port)
+	useTLS := conf.TLSCertFile != "" || conf.TLSKeyFile != ""
+	log.Info().
+		Str("address", address).
+		Bool("tls", useTLS).
+		Bool("authentication", conf.Username != "" || conf.BearerToken != "").
+		Msg("Starting http listener")
+
+	name := conf.Name
+	if name == "" {
+		name = address
+	}
+	source := source{typ: "http_listener", name: name}
+
+	serverMuxA := http.NewServeMux()
+	serverMuxA.HandleFunc("/", httpListenerHandler(conf, source, measurements))
+	server := &http.Server{Addr: address, Handler: serverMuxA}
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the TLS certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	// listening before returning, so that a failure can be reported to the caller
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start http listener: %w", err)
+	}
+	go func() {
+		var err error
+		if useTLS {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Str("address", address).Err(err).Msg("http listener failed")
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		log.Info().Str("address", address).Msg("Stopping http listener")
+		// waits for the requests in progress to finish, but not for the clients holding their connections open
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpListenerShutdownTimeout)
+		server.Shutdown(shutdownCtx)
+		cancel()
+		close(done)
+	}()
+	return done, nil
+}
 
+// httpListenerHandler returns the handler for the data posted by the gateway
+func httpListenerHandler(conf config.HTTPListener, source source, measurements chan<- parser.Measurement) http.HandlerFunc {
+	maxBodySize := conf.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = 1024 * 1024
+	}
+	var mu sync.Mutex
 	seenTags := make(map[string]int64)
 
-	handlerFunc := func(w http.ResponseWriter, req *http.Request) {
-		body, err := io.ReadAll(req.Body)
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !httpListenerAuthorized(conf, req) {
+			log.Warn().Str("path", req.URL.Path).Str("remote_address", req.RemoteAddr).Msg("Unauthorized http call")
+			if conf.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="RuuviBridge"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
 		if err != nil {
 			log.Error().Str("path", req.URL.Path).Err(err).Msg("Failed to read request body")
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			} else {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+			}
 			return
 		}
 		req.Body.Close()
+		record(source, "", req.URL.Path, body)
 		logger := log.With().
 			Str("path", req.URL.Path).
 			Str("body", string(body)).
@@ -38,33 +133,30 @@ func StartHTTPListener(conf config.HTTPListener, measurements chan<- parser.Meas
 		err = json.Unmarshal(body, &gatewayHistory)
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to deserialize http listener data")
+			http.Error(w, "invalid data", http.StatusBadRequest)
 			return
 		}
 
-		for mac, data := range gatewayHistory.Data.Tags {
-			mac = strings.ToUpper(mac)
-			timestamp := data.Timestamp
-			if seenTags[mac] == timestamp {
-				continue
-			}
-			seenTags[mac] = timestamp
-			measurement, ok := parser.Parse(data.Data)
-			if ok {
-				measurement.Mac = mac
-				measurement.Rssi = &data.Rssi
-				measurement.Timestamp = &timestamp
-				measurements <- measurement
-			}
-		}
+		mu.Lock()
+		defer mu.Unlock()
+		handleGatewayHistory(source, gatewayHistory, seenTags, measurements)
 	}
+}
 
-	serverMuxA := http.NewServeMux()
-	serverMuxA.HandleFunc("/", handlerFunc)
-	go http.ListenAndServe(fmt.Sprintf(":%d", port), serverMuxA)
-
-	stop := make(chan bool)
-	go func() {
-		<-stop
-	}()
-	return stop
+// httpListenerAuthorized checks the credentials of the request, matching the authentication options of the custom
+// http server settings of the Ruuvi Gateway. Either basic or bearer authentication is accepted when both are configured
+func httpListenerAuthorized(conf config.HTTPListener, req *http.Request) bool {
+	if conf.Username == "" && conf.BearerToken == "" {
+		return true
+	}
+	if username, password, ok := req.BasicAuth(); ok && conf.Username != "" {
+		usernameOk := subtle.ConstantTimeCompare([]byte(username), []byte(conf.Username)) == 1
+		passwordOk := subtle.ConstantTimeCompare([]byte(password), []byte(conf.Password)) == 1
+		return usernameOk && passwordOk
+	}
+	if conf.BearerToken != "" {
+		expected := "Bearer " + conf.BearerToken
+		return subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte(expected)) == 1
+	}
+	return false
 }
@@ -0,0 +1,62 @@
+package data_sources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func TestHTTPListenerHandler(t *testing.T) {
+	history := `{"data":{"gw_mac":"C8:25:2D:8E:9C:2C","tags":{"CB:B8:33:4C:88:4F":{"rssi":-70,"timestamp":1704110401,"data":"` + testFormat5Data + `"}}}}`
+	conf := config.HTTPListener{
+		Username:    "user",
+		Password:    "pass",
+		BearerToken: "token",
+		MaxBodySize: 1024,
+	}
+	tests := []struct {
+		name   string
+		body   string
+		auth   func(req *http.Request)
+		status int
+		parsed bool
+	}{
+		{"basic auth", history, func(req *http.Request) { req.SetBasicAuth("user", "pass") }, http.StatusOK, true},
+		{"bearer auth", history, func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") }, http.StatusOK, true},
+		{"no auth", history, func(req *http.Request) {}, http.StatusUnauthorized, false},
+		{"wrong password", history, func(req *http.Request) { req.SetBasicAuth("user", "wrong") }, http.StatusUnauthorized, false},
+		{"wrong token", history, func(req *http.Request) { req.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized, false},
+		{"invalid json", "{", func(req *http.Request) { req.SetBasicAuth("user", "pass") }, http.StatusBadRequest, false},
+		{"too large", strings.Repeat(" ", 1025) + history, func(req *http.Request) { req.SetBasicAuth("user", "pass") }, http.StatusRequestEntityTooLarge, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			measurements := make(chan parser.Measurement, 1)
+			handler := httpListenerHandler(conf, source{typ: "http_listener", name: "test"}, measurements)
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			test.auth(req)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != test.status {
+				t.Errorf("status: got %d want %d", w.Code, test.status)
+			}
+			if parsed := len(measurements) == 1; parsed != test.parsed {
+				t.Errorf("parsed: got %v want %v", parsed, test.parsed)
+			}
+		})
+	}
+}
+
+func TestHTTPListenerHandler_NoAuth(t *testing.T) {
+	handler := httpListenerHandler(config.HTTPListener{}, source{}, make(chan parser.Measurement, 1))
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"data":{"tags":{}}}`))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("status: got %d want %d", w.Code, http.StatusOK)
+	}
+}
@@ -1,8 +1,10 @@
 package data_sources
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -23,7 +25,11 @@ type message struct {
 	Coords string        `json:"coords"`
 }
 
-func StartMQTTListener(conf config.MQTTListener, measurements chan<- parser.Measurement) chan<- bool {
+// mqttListenerServer returns the url of the broker
+func mqttListenerServer(conf config.MQTTListener) string {
+	if conf.BrokerUrl != "" {
+		return conf.BrokerUrl
+	}
 	address := conf.BrokerAddress
 	if address == "" {
 		address = "localhost"
@@ -32,10 +38,25 @@ func StartMQTTListener(conf config.MQTTListener, measurements chan<- parser.Meas
 	if port == 0 {
 		port = 1883
 	}
-	server := conf.BrokerUrl
-	if server == "" {
-		server = fmt.Sprintf("tcp://%s:%d", address, port)
+	return fmt.Sprintf("tcp://%s:%d", address, port)
+}
+
+// ValidateMQTTListener checks the mqtt_listener config without connecting to the broker
+func ValidateMQTTListener(conf config.MQTTListener) error {
+	server, err := url.Parse(mqttListenerServer(conf))
+	if err != nil {
+		return fmt.Errorf("invalid broker url: %w", err)
 	}
+	switch server.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "mqtt+ssl", "tcps", "ws", "wss", "unix":
+	default:
+		return fmt.Errorf("unsupported scheme in broker url: %q", server.Scheme)
+	}
+	return nil
+}
+
+func StartMQTTListener(ctx context.Context, conf config.MQTTListener, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+	server := mqttListenerServer(conf)
 	subscription := conf.TopicPrefix + "/+"
 	log := log.With().
 		Str("target", server).
@@ -45,24 +66,17 @@ func StartMQTTListener(conf config.MQTTListener, measurements chan<- parser.Meas
 
 	log.Info().Msg("Starting MQTT subscriber")
 
+	name := conf.Name
+	if name == "" {
+		name = server
+	}
+	source := source{typ: "mqtt_listener", name: name}
+
 	messagePubHandler := func(client mqtt.Client, msg mqtt.Message) {
-		topic := msg.Topic()
-		var message message
-		err := json.Unmarshal(msg.Payload(), &message)
+		record(source, msg.Topic(), "", msg.Payload())
+		err := handleMQTTMessage(source, msg.Topic(), msg.Payload(), measurements)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to deserialize MQTT message")
-			return
-		}
-
-		mac := strings.ToUpper(topic[strings.LastIndex(topic, "/")+1:])
-		timestamp, _ := strconv.ParseInt(fmt.Sprint(message.Ts), 10, 64)
-
-		measurement, ok := parser.Parse(message.Data)
-		if ok {
-			measurement.Mac = mac
-			measurement.Rssi = &message.Rssi
-			measurement.Timestamp = &timestamp
-			measurements <- measurement
 		}
 	}
 	clientID := conf.ClientID
@@ -87,10 +101,11 @@ func StartMQTTListener(conf config.MQTTListener, measurements chan<- parser.Meas
 	}
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatal().Err(token.Error()).Msg("Failed to connect to MQTT")
+		return nil, fmt.Errorf("failed to connect to MQTT: %w", token.Error())
 	}
 	if token := client.Subscribe(subscription, 0, messagePubHandler); token.Wait() && token.Error() != nil {
-		log.Fatal().Err(token.Error()).Msg("Failed to subscribe to MQTT topic")
+		client.Disconnect(250)
+		return nil, fmt.Errorf("failed to subscribe to MQTT topic: %w", token.Error())
 	}
 	if conf.LWTTopic != "" {
 		payload := conf.LWTOnlinePayload
@@ -99,10 +114,41 @@ func StartMQTTListener(conf config.MQTTListener, measurements chan<- parser.Meas
 		}
 		client.Publish(conf.LWTTopic, 0, true, payload)
 	}
-	stop := make(chan bool)
+	done := make(chan struct{})
 	go func() {
-		<-stop
-		client.Disconnect(0)
+		<-ctx.Done()
+		log.Info().Msg("Stopping MQTT subscriber")
+		client.Unsubscribe(subscription).WaitTimeout(time.Second)
+		if conf.LWTTopic != "" {
+			// the will is not published on a graceful disconnect
+			payload := conf.LWTOfflinePayload
+			if payload == "" {
+				payload = "{\"state\":\"offline\"}"
+			}
+			client.Publish(conf.LWTTopic, 0, true, payload).WaitTimeout(time.Second)
+		}
+		client.Disconnect(250)
+		close(done)
 	}()
-	return stop
+	return done, nil
+}
+
+// handleMQTTMessage parses a message in Ruuvi Gateway format, published to a topic ending with the mac address of the tag
+func handleMQTTMessage(source source, topic string, payload []byte, measurements chan<- parser.Measurement) error {
+	var message message
+	err := json.Unmarshal(payload, &message)
+	if err != nil {
+		return err
+	}
+
+	mac := strings.ToUpper(topic[strings.LastIndex(topic, "/")+1:])
+	timestamp, _ := strconv.ParseInt(fmt.Sprint(message.Ts), 10, 64)
+
+	measurement, ok := source.parse(mac, message.GwMac, message.Data)
+	if ok {
+		measurement.Rssi = &message.Rssi
+		measurement.Timestamp = &timestamp
+		measurements <- measurement
+	}
+	return nil
 }
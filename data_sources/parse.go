@@ -0,0 +1,83 @@
+package data_sources
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/common/metrics"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// parseFailures counts the data that failed to parse for each tag. Only the tags that have been parsed successfully are
+// counted, so that packets with spoofed or random mac addresses do not grow the map
+var parseFailures = struct {
+	sync.Mutex
+	counts map[string]int64
+}{
+	counts: make(map[string]int64),
+}
+
+// source identifies the data source that received the data
+type source struct {
+	typ  string
+	name string
+	// receiveTime is the time the data was originally received when replaying a recording, the current time if zero
+	receiveTime time.Time
+}
+
+// parse parses the data received from the tag with the given mac address, counting the failures per tag after it has
+// been parsed successfully once. Data in unknown formats is not counted, as gateways may relay data from any bluetooth
+// device.
+// The gateway mac address may be empty if the data source does not know it
+func (s source) parse(mac string, gatewayMac string, data string) (parser.Measurement, bool) {
+	receiveTime := time.Now().UnixMilli()
+	if !s.receiveTime.IsZero() {
+		receiveTime = s.receiveTime.UnixMilli()
+	}
+	measurement, err := parser.Decode(data)
+	if err != nil {
+		var parseErr *parser.ParseError
+		if !errors.As(err, &parseErr) {
+			parseErr = &parser.ParseError{Reason: parser.ReasonInvalidValue, Err: err}
+		}
+		log.Trace().
+			Str("mac", mac).
+			Str("raw_data", data).
+			Str("reason", parseErr.Reason.String()).
+			Err(err).
+			Msg("Failed to parse data")
+		if parseErr.Reason != parser.ReasonUnknownFormat {
+			parseFailures.Lock()
+			if _, seen := parseFailures.counts[mac]; seen {
+				parseFailures.counts[mac]++
+			}
+			parseFailures.Unlock()
+			metrics.ParseFailures.WithLabelValues(parseErr.Format, parseErr.Reason.String()).Inc()
+		}
+		return parser.Measurement{}, false
+	}
+	log.Trace().
+		Str("mac", mac).
+		Str("raw_data", data).
+		Str("data_format", measurement.FormatName()).
+		Msg("Successfully parsed data")
+
+	parseFailures.Lock()
+	failures := parseFailures.counts[mac]
+	parseFailures.counts[mac] = failures // starts counting the failures of the tag
+	parseFailures.Unlock()
+	measurement.Mac = mac
+	measurement.ParseFailures = &failures
+	if gatewayMac != "" {
+		gatewayMac = strings.ToUpper(gatewayMac)
+		measurement.GatewayMac = &gatewayMac
+	}
+	measurement.SourceType = s.typ
+	measurement.SourceName = s.name
+	measurement.ReceiveTime = &receiveTime
+	measurement.RawData = data
+	return measurement, true
+}
@@ -0,0 +1,57 @@
+package data_sources
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_ParseFailures(t *testing.T) {
+	s := source{typ: "test", name: "test"}
+	malformed := testFormat5Data[:20]
+
+	if _, ok := s.parse("AA:BB:CC:DD:EE:01", "", malformed); ok {
+		t.Fatalf("expected the malformed data to fail")
+	}
+	parseFailures.Lock()
+	_, counted := parseFailures.counts["AA:BB:CC:DD:EE:01"]
+	parseFailures.Unlock()
+	if counted {
+		t.Errorf("expected a tag never parsed successfully not to be counted")
+	}
+
+	m, ok := s.parse("AA:BB:CC:DD:EE:01", "", testFormat5Data)
+	if !ok || m.ParseFailures == nil || *m.ParseFailures != 0 {
+		t.Fatalf("expected no failures counted before the first successful parse, got %v", m.ParseFailures)
+	}
+	s.parse("AA:BB:CC:DD:EE:01", "", malformed)
+	m, _ = s.parse("AA:BB:CC:DD:EE:01", "", testFormat5Data)
+	if m.ParseFailures == nil || *m.ParseFailures != 1 {
+		t.Errorf("expected the failure after a successful parse to be counted, got %v", m.ParseFailures)
+	}
+}
+
+func TestParse_SourceIdentity(t *testing.T) {
+	s := source{typ: "gateway_polling", name: "gateway"}
+	before := time.Now().UnixMilli()
+	m, ok := s.parse("AA:BB:CC:DD:EE:02", "c8:25:2d:8e:9c:2c", testFormat5Data)
+	if !ok {
+		t.Fatalf("expected the data to parse")
+	}
+	if m.GatewayMac == nil || *m.GatewayMac != "C8:25:2D:8E:9C:2C" {
+		t.Errorf("expected the gateway mac to be uppercased, got %v", m.GatewayMac)
+	}
+	if m.SourceType != "gateway_polling" || m.SourceName != "gateway" {
+		t.Errorf("expected the source identity, got %s/%s", m.SourceType, m.SourceName)
+	}
+	if m.ReceiveTime == nil || *m.ReceiveTime < before || *m.ReceiveTime > time.Now().UnixMilli() {
+		t.Errorf("expected the receive time to be the current time, got %v", m.ReceiveTime)
+	}
+
+	m, ok = s.parse("AA:BB:CC:DD:EE:02", "", testFormat5Data)
+	if !ok {
+		t.Fatalf("expected the data to parse")
+	}
+	if m.GatewayMac != nil {
+		t.Errorf("expected no gateway mac without one, got %v", *m.GatewayMac)
+	}
+}
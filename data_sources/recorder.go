@@ -0,0 +1,151 @@
+package data_sources
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/rs/zerolog/log"
+)
+
+// trafficRecorder appends the raw payloads received by the data sources to a file, which is rotated when it grows
+// larger than maxSize. The rotated files are named <file>.1 (the newest) to <file>.<maxFiles>
+type trafficRecorder struct {
+	mu       sync.Mutex
+	file     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+// recorder is the recorder used by all data sources, nil if recording is disabled
+var recorder atomic.Pointer[trafficRecorder]
+
+// StartRecorder starts recording the raw payloads received by the data sources. The returned function stops the
+// recording, and should be called after the data sources have stopped
+func StartRecorder(conf config.Recorder) (func(), error) {
+	file := conf.File
+	if file == "" {
+		file = "recording.jsonl"
+	}
+	maxSize := conf.MaxSize
+	if maxSize == 0 {
+		maxSize = 100 * 1024 * 1024
+	}
+	maxFiles := conf.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = 5
+	}
+	log.Info().
+		Str("file", file).
+		Int64("max_size", maxSize).
+		Int("max_files", maxFiles).
+		Msg("Starting raw traffic recorder")
+
+	r, err := newTrafficRecorder(file, maxSize, maxFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the recording: %w", err)
+	}
+	recorder.Store(r)
+	return func() {
+		recorder.Store(nil)
+		r.close()
+	}, nil
+}
+
+func newTrafficRecorder(file string, maxSize int64, maxFiles int) (*trafficRecorder, error) {
+	r := &trafficRecorder{file: file, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *trafficRecorder) open() error {
+	f, err := os.OpenFile(r.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file to <file>.1, shifting the older files and removing the oldest, and opens a new file
+func (r *trafficRecorder) rotate() error {
+	r.f.Close()
+	r.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", r.file, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.file, i), fmt.Sprintf("%s.%d", r.file, i+1))
+	}
+	if err := os.Rename(r.file, r.file+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *trafficRecorder) write(message recordedMessage) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)                    // keeps the JSON payloads as received
+	if err := encoder.Encode(message); err != nil { // appends a newline
+		return err
+	}
+	line := buf.Bytes()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return fmt.Errorf("recording %s is closed", r.file)
+	}
+	if r.size > 0 && r.size+int64(len(line)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.f.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+func (r *trafficRecorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
+
+// record records the raw payload received by the source, if recording is enabled. Topic is the MQTT topic or path the
+// HTTP path of the payload
+func record(source source, topic string, path string, payload []byte) {
+	r := recorder.Load()
+	if r == nil {
+		return
+	}
+	message := recordedMessage{
+		Time:       time.Now(),
+		SourceType: source.typ,
+		Source:     source.name,
+		Topic:      topic,
+		Path:       path,
+	}
+	message.setPayload(payload)
+	err := r.write(message)
+	if err != nil {
+		log.Error().Str("file", r.file).Err(err).Msg("Failed to record raw traffic")
+	}
+}
@@ -0,0 +1,107 @@
+package data_sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+)
+
+func TestTrafficRecorder_Rotate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "recording.jsonl")
+	r, err := newTrafficRecorder(file, 200, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	message := recordedMessage{SourceType: "http_listener", Source: "test", Path: "/", Payload: json.RawMessage(`{"data":{"tags":{}}}`)}
+	for i := 0; i < 10; i++ {
+		if err := r.write(message); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	for _, name := range []string{file, file + ".1", file + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("expected %s to be rotated at 200 bytes, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 rotated files to be kept")
+	}
+}
+
+func TestRecord_Replay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "recording.jsonl")
+	r, err := newTrafficRecorder(file, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Store(r)
+	payload := []byte(`{"gw_mac":"C8:25:2D:8E:9C:2C","rssi":-60,"ts":"1704110400","data":"` + testFormat5Data + `"}`)
+	record(source{typ: "mqtt_listener", name: "broker"}, "ruuvi/CB:B8:33:4C:88:4F", "", payload)
+	recorder.Store(nil)
+	r.close()
+
+	recording, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurements := make(chan parser.Measurement, 1)
+	replay(context.Background(), bytes.NewReader(recording), 0, measurements, zerolog.Nop())
+	select {
+	case m := <-measurements:
+		if m.Mac != "CB:B8:33:4C:88:4F" || m.SourceName != "broker" {
+			t.Errorf("got mac %s source %s", m.Mac, m.SourceName)
+		}
+	default:
+		t.Fatalf("expected the recorded message to be replayed")
+	}
+}
+
+func TestRecordedMessage_Payload(t *testing.T) {
+	payloads := [][]byte{
+		[]byte(`{"data":{"tags":{}},"note":"<&>"}`),
+		[]byte("{\"data\": {\"tags\": {}}}\n"),
+		{0xff, 0xfe, '{'},
+	}
+	file := filepath.Join(t.TempDir(), "recording.jsonl")
+	r, err := newTrafficRecorder(file, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range payloads {
+		message := recordedMessage{SourceType: "http_listener"}
+		message.setPayload(payload)
+		if err := r.write(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.close()
+
+	recording, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(recording), []byte("\n"))
+	if len(lines) != len(payloads) {
+		t.Fatalf("expected %d recorded messages, got %d", len(payloads), len(lines))
+	}
+	for i, line := range lines {
+		var message recordedMessage
+		if err := json.Unmarshal(line, &message); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(message.payload(), payloads[i]) {
+			t.Errorf("expected the payload %q to be kept as is, got %q", payloads[i], message.payload())
+		}
+	}
+}
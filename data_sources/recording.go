@@ -0,0 +1,38 @@
+package data_sources
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// recordedMessage is a raw payload received by a data source, one per line in a recording
+type recordedMessage struct {
+	Time       time.Time `json:"time"`            // Time the payload was received
+	SourceType string    `json:"source_type"`     // Type of the source that received the payload, determines the format of the payload
+	Source     string    `json:"source"`          // Name of the source that received the payload
+	Topic      string    `json:"topic,omitempty"` // MQTT topic the payload was published to, for mqtt_listener
+	Path       string    `json:"path,omitempty"`  // HTTP path of the request, for gateway_polling and http_listener
+	// MQTT message or gateway history as received, or a bluez_log advertising report. The payload is stored as is when
+	// it is compact JSON, and base64 encoded otherwise, so that it is replayed exactly as received
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	PayloadBase64 []byte          `json:"payload_base64,omitempty"`
+}
+
+// setPayload stores the payload in the field that keeps it intact
+func (m *recordedMessage) setPayload(payload []byte) {
+	var compacted bytes.Buffer
+	if json.Valid(payload) && json.Compact(&compacted, payload) == nil && bytes.Equal(compacted.Bytes(), payload) {
+		m.Payload = json.RawMessage(payload)
+	} else {
+		m.PayloadBase64 = payload
+	}
+}
+
+// payload returns the payload as received
+func (m recordedMessage) payload() []byte {
+	if m.Payload != nil {
+		return m.Payload
+	}
+	return m.PayloadBase64
+}
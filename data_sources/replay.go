@@ -0,0 +1,136 @@
+package data_sources
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRecordedMessageSize is the maximum length of a line in a recording, a gateway history can be quite large
+const maxRecordedMessageSize = 16 * 1024 * 1024
+
+// ValidateReplay checks the replay config without starting the replay
+func ValidateReplay(conf config.Replay) error {
+	if conf.Speed != nil && *conf.Speed < 0 {
+		return fmt.Errorf("replay speed cannot be negative, got %g", *conf.Speed)
+	}
+	if _, err := os.Stat(conf.File); err != nil {
+		return fmt.Errorf("failed to open the recording: %w", err)
+	}
+	return nil
+}
+
+func StartReplay(ctx context.Context, conf config.Replay, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+	if err := ValidateReplay(conf); err != nil {
+		return nil, err
+	}
+	speed := 1.0
+	if conf.Speed != nil {
+		speed = *conf.Speed
+	}
+	logger := log.With().
+		Str("file", conf.File).
+		Float64("speed", speed).
+		Logger()
+	logger.Info().Msg("Starting replay")
+
+	f, err := os.Open(conf.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the recording: %w", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer f.Close()
+		if replay(ctx, f, speed, measurements, logger) {
+			logger.Info().Msg("Replay finished")
+		}
+	}()
+	return done, nil
+}
+
+// replay feeds the recorded messages to the measurements. Speed is relative to real time, 0 replays as fast as
+// possible. Returns false if stopped before reaching the end of the recording
+func replay(ctx context.Context, r io.Reader, speed float64, measurements chan<- parser.Measurement, logger zerolog.Logger) bool {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordedMessageSize)
+	seenTags := make(map[string]map[string]int64)
+	var first time.Time
+	start := time.Now()
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record recordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logger.Warn().Int("line", line).Err(err).Msg("Failed to deserialize recorded message")
+			continue
+		}
+
+		if first.IsZero() {
+			first = record.Time
+		}
+		if speed > 0 {
+			delay := time.Duration(float64(record.Time.Sub(first))/speed) - time.Since(start)
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					return false
+				case <-time.After(delay):
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		source := source{typ: "replay", name: record.Source, receiveTime: record.Time}
+		switch record.SourceType {
+		case "mqtt_listener":
+			if err := handleMQTTMessage(source, record.Topic, record.payload(), measurements); err != nil {
+				logger.Warn().Int("line", line).Err(err).Msg("Failed to deserialize recorded MQTT message")
+			}
+		case "gateway_polling", "http_listener":
+			var gatewayHistory gatewayHistory
+			if err := json.Unmarshal(record.payload(), &gatewayHistory); err != nil {
+				logger.Warn().Int("line", line).Err(err).Msg("Failed to deserialize recorded gateway data")
+				continue
+			}
+			if seenTags[record.Source] == nil {
+				seenTags[record.Source] = make(map[string]int64)
+			}
+			handleGatewayHistory(source, gatewayHistory, seenTags[record.Source], measurements)
+		case "bluez_log":
+			var report recordedReport
+			if err := json.Unmarshal(record.payload(), &report); err != nil {
+				logger.Warn().Int("line", line).Err(err).Msg("Failed to deserialize recorded advertising report")
+				continue
+			}
+			data, err := hex.DecodeString(report.Data)
+			if err != nil {
+				logger.Warn().Int("line", line).Err(err).Msg("Failed to deserialize recorded advertising report")
+				continue
+			}
+			handleAdvertisingReport(source, advertisingReport{mac: report.Mac, rssi: report.Rssi, data: data}, measurements)
+		default:
+			logger.Warn().Int("line", line).Str("source_type", record.SourceType).Msg("Unrecognized source type in recorded message")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error().Int("line", line).Err(err).Msg("Failed to read the recording")
+	}
+	return true
+}
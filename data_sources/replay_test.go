@@ -0,0 +1,105 @@
+package data_sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+)
+
+const testFormat5Data = "0201061BFF99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := `{"data":{"gw_mac":"C8:25:2D:8E:9C:2C","tags":{"CB:B8:33:4C:88:4F":{"rssi":-70,"timestamp":1704110401,"data":"` + testFormat5Data + `"}}}}`
+	records := []recordedMessage{
+		{Time: start, SourceType: "mqtt_listener", Source: "broker", Topic: "ruuvi/cb:b8:33:4c:88:4f",
+			Payload: json.RawMessage(`{"gw_mac":"C8:25:2D:8E:9C:2C","rssi":-60,"ts":"1704110400","data":"` + testFormat5Data + `"}`)},
+		{Time: start.Add(time.Second), SourceType: "gateway_polling", Source: "gateway", Path: "/history", Payload: json.RawMessage(history)},
+		{Time: start.Add(2 * time.Second), SourceType: "gateway_polling", Source: "gateway", Path: "/history", Payload: json.RawMessage(history)},
+		{Time: start.Add(3 * time.Second), SourceType: "unknown", Source: "other", Payload: json.RawMessage("{}")},
+	}
+	var recording bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recording.Write(line)
+		recording.WriteString("\n")
+	}
+	recording.WriteString("not json\n")
+
+	measurements := make(chan parser.Measurement, 10)
+	if !replay(context.Background(), &recording, 0, measurements, zerolog.Nop()) {
+		t.Fatalf("expected the replay to finish")
+	}
+	close(measurements)
+
+	var got []parser.Measurement
+	for m := range measurements {
+		got = append(got, m)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 measurements, the repeated gateway history should be skipped, got %d", len(got))
+	}
+	expected := []struct {
+		rssi       int64
+		timestamp  int64
+		sourceName string
+	}{
+		{-60, 1704110400, "broker"},
+		{-70, 1704110401, "gateway"},
+	}
+	for i, m := range got {
+		if m.Mac != "CB:B8:33:4C:88:4F" {
+			t.Errorf("measurement %d Mac: got %s", i, m.Mac)
+		}
+		if m.GatewayMac == nil || *m.GatewayMac != "C8:25:2D:8E:9C:2C" {
+			t.Errorf("measurement %d GatewayMac: got %v", i, m.GatewayMac)
+		}
+		if m.SourceType != "replay" || m.SourceName != expected[i].sourceName {
+			t.Errorf("measurement %d source: got %s/%s", i, m.SourceType, m.SourceName)
+		}
+		if *m.Rssi != expected[i].rssi || *m.Timestamp != expected[i].timestamp {
+			t.Errorf("measurement %d: got rssi %d timestamp %d", i, *m.Rssi, *m.Timestamp)
+		}
+		if m.Temperature == nil || *m.Temperature != 24.3 {
+			t.Errorf("measurement %d Temperature: got %v", i, m.Temperature)
+		}
+		if m.ReceiveTime == nil || *m.ReceiveTime != records[i].Time.UnixMilli() {
+			t.Errorf("measurement %d ReceiveTime: got %v, expected the recorded time", i, m.ReceiveTime)
+		}
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	speed := -1.0
+	if err := ValidateReplay(config.Replay{File: "testdata/hcidump.log", Speed: &speed}); err == nil {
+		t.Errorf("expected an error for a negative speed")
+	}
+	speed = 0
+	if err := ValidateReplay(config.Replay{File: "testdata/hcidump.log", Speed: &speed}); err != nil {
+		t.Errorf("expected the speed 0 to be valid, got %v", err)
+	}
+}
+
+func TestReplay_Stop(t *testing.T) {
+	start := time.Now()
+	var recording bytes.Buffer
+	for _, offset := range []time.Duration{0, time.Hour} {
+		line, _ := json.Marshal(recordedMessage{Time: start.Add(offset), SourceType: "http_listener", Payload: json.RawMessage(`{"data":{"tags":{}}}`)})
+		recording.Write(line)
+		recording.WriteString("\n")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if replay(ctx, &recording, 1, make(chan parser.Measurement), zerolog.Nop()) {
+		t.Errorf("expected the replay to stop while waiting for the next message")
+	}
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// AD types, see Bluetooth Assigned Numbers, section 2.3
+const (
+	adTypeFlags            = 0x01
+	adTypeShortenedName    = 0x08
+	adTypeCompleteName     = 0x09
+	adTypeTxPowerLevel     = 0x0a
+	adTypeServiceData16    = 0x16
+	adTypeManufacturerData = 0xff
+)
+
+const ruuviCompanyIdentifier = 0x0499
+
+type ServiceData struct {
+	UUID uint16
+	Data []byte
+}
+
+type ManufacturerData struct {
+	CompanyID uint16
+	Data      []byte
+}
+
+// Advertisement contains the AD structures of a BLE advertisement. Data slices point to the original advertisement data
+type Advertisement struct {
+	Flags            *byte
+	LocalName        *string
+	TxPowerLevel     *int8
+	ServiceData      []ServiceData
+	ManufacturerData []ManufacturerData
+}
+
+var errADStructureLength = errors.New("AD structure length exceeds data length")
+
+// adIterator iterates over the AD structures of advertisement data without copying or allocating
+type adIterator struct {
+	data []byte
+	err  error
+}
+
+// next returns the next AD structure, or false when there are no more structures or the data is malformed
+func (it *adIterator) next() (byte, []byte, bool) {
+	if len(it.data) == 0 {
+		return 0, nil, false
+	}
+	length := int(it.data[0])
+	if length == 0 { // early termination, the rest is padding
+		return 0, nil, false
+	}
+	if length >= len(it.data) {
+		it.err = errADStructureLength
+		return 0, nil, false
+	}
+	adType := it.data[1]
+	value := it.data[2 : length+1]
+	it.data = it.data[length+1:]
+	return adType, value, true
+}
+
+// ParseAdvertisement walks through all AD structures of the advertisement data
+func ParseAdvertisement(data []byte) (Advertisement, error) {
+	var adv Advertisement
+	it := adIterator{data: data}
+	for adType, value, ok := it.next(); ok; adType, value, ok = it.next() {
+		switch adType {
+		case adTypeServiceData16:
+			if len(value) >= 2 {
+				adv.ServiceData = append(adv.ServiceData, ServiceData{UUID: binary.LittleEndian.Uint16(value[0:2]), Data: value[2:]})
+			}
+		case adTypeManufacturerData:
+			if len(value) >= 2 {
+				adv.ManufacturerData = append(adv.ManufacturerData, ManufacturerData{CompanyID: binary.LittleEndian.Uint16(value[0:2]), Data: value[2:]})
+			}
+		default:
+			adv.addStructure(adType, value)
+		}
+	}
+	return adv, it.err
+}
+
+// addStructure adds the AD structures other than service and manufacturer data to the advertisement
+func (adv *Advertisement) addStructure(adType byte, value []byte) {
+	switch adType {
+	case adTypeFlags:
+		if len(value) >= 1 {
+			adv.Flags = &value[0]
+		}
+	case adTypeShortenedName:
+		if adv.LocalName == nil { // prefer complete name if both are present
+			name := string(value)
+			adv.LocalName = &name
+		}
+	case adTypeCompleteName:
+		name := string(value)
+		adv.LocalName = &name
+	case adTypeTxPowerLevel:
+		if len(value) >= 1 {
+			txPower := int8(value[0])
+			adv.TxPowerLevel = &txPower
+		}
+	}
+}
+
+// FindServiceData returns the service data for the given 16-bit service UUID, or nil if not present
+func (adv Advertisement) FindServiceData(uuid uint16) []byte {
+	for _, sd := range adv.ServiceData {
+		if sd.UUID == uuid {
+			return sd.Data
+		}
+	}
+	return nil
+}
+
+// FindManufacturerData returns the manufacturer specific data for the given company identifier, or nil if not present
+func (adv Advertisement) FindManufacturerData(companyID uint16) []byte {
+	for _, md := range adv.ManufacturerData {
+		if md.CompanyID == companyID {
+			return md.Data
+		}
+	}
+	return nil
+}
+
+// ruuviManufacturerData returns the Ruuvi manufacturer specific data, starting from the data format byte.
+// If the advertisement is malformed or doesn't contain the data where expected, the manufacturer data is
+// looked up at the given fixed offset for compatibility with older gateways and tools
+func ruuviManufacturerData(data []byte, legacyOffset int) (Advertisement, []byte, error) {
+	adv, err := ParseAdvertisement(data)
+	if err == nil {
+		if payload := adv.FindManufacturerData(ruuviCompanyIdentifier); len(payload) > 0 {
+			return adv, payload, nil
+		}
+	} else {
+		adv = Advertisement{}
+	}
+	payload, err := legacyRuuviManufacturerData(data, legacyOffset)
+	return adv, payload, err
+}
+
+// legacyRuuviManufacturerData returns the Ruuvi manufacturer specific data at the given fixed offset
+func legacyRuuviManufacturerData(data []byte, offset int) ([]byte, error) {
+	if len(data) <= offset+3 {
+		return nil, newParseError(ReasonTooShort, len(data), "", "data is too short")
+	}
+	if data[offset] != adTypeManufacturerData {
+		return nil, newParseError(ReasonWrongFormat, offset, "", "data is not manufacturer specific data")
+	}
+	if binary.LittleEndian.Uint16(data[offset+1:]) != ruuviCompanyIdentifier {
+		return nil, newParseError(ReasonWrongFormat, offset+1, "", "data has wrong company identifier")
+	}
+	return data[offset+3:], nil
+}
+
+// applyAdvertisement adds the data from the other AD structures to the measurement
+func applyAdvertisement(m *Measurement, adv Advertisement) {
+	m.LocalName = adv.LocalName
+	if adv.Flags != nil {
+		m.AdvertisementFlags = i64(int64(*adv.Flags))
+	}
+	if adv.TxPowerLevel != nil {
+		m.TxPowerLevel = i64(int64(*adv.TxPowerLevel))
+	}
+}
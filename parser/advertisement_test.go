@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseAdvertisement_OK(t *testing.T) {
+	data := []byte{
+		0x02, 0x01, 0x06, // Flags
+		0x02, 0x0A, 0xF8, // TX power level (-8 dBm)
+		0x05, 0x09, 'R', 'u', 'u', 'v', // Complete local name
+		0x05, 0x16, 0xAA, 0xFE, 0x01, 0x02, // Service data (0xFEAA)
+		0x05, 0xFF, 0x99, 0x04, 0x05, 0x12, // Manufacturer data (0x0499)
+	}
+
+	adv, err := ParseAdvertisement(data)
+	if err != nil {
+		t.Fatalf("ParseAdvertisement returned error: %v", err)
+	}
+
+	if adv.Flags == nil || *adv.Flags != 0x06 {
+		t.Errorf("Flags: got %v want %v", adv.Flags, 0x06)
+	}
+	if adv.TxPowerLevel == nil || *adv.TxPowerLevel != -8 {
+		t.Errorf("TxPowerLevel: got %v want %v", adv.TxPowerLevel, -8)
+	}
+	if adv.LocalName == nil || *adv.LocalName != "Ruuv" {
+		t.Errorf("LocalName: got %v want %v", adv.LocalName, "Ruuv")
+	}
+	if sd := adv.FindServiceData(0xFEAA); hex.EncodeToString(sd) != "0102" {
+		t.Errorf("ServiceData: got %x want %v", sd, "0102")
+	}
+	if md := adv.FindManufacturerData(0x0499); hex.EncodeToString(md) != "0512" {
+		t.Errorf("ManufacturerData: got %x want %v", md, "0512")
+	}
+	if md := adv.FindManufacturerData(0x004C); md != nil {
+		t.Errorf("ManufacturerData: expected nil for unknown company, got %x", md)
+	}
+}
+
+func TestParseAdvertisement_Malformed(t *testing.T) {
+	data := []byte{0x02, 0x01, 0x06, 0x1B, 0xFF, 0x99, 0x04, 0x05}
+
+	if _, err := ParseAdvertisement(data); err == nil {
+		t.Errorf("ParseAdvertisement: expected error for truncated AD structure")
+	}
+}
+
+func TestParseFormat5_WithLocalName(t *testing.T) {
+	payload := []byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	// Local name and a different flags record before the manufacturer data
+	adv := []byte{0x02, 0x01, 0x1A, 0x0A, 0x09, 'R', 'u', 'u', 'v', 'i', ' ', '8', '8', '4', 0x1B, 0xFF, 0x99, 0x04}
+	adv = append(adv, payload...)
+
+	m, err := ParseFormat5(hex.EncodeToString(adv))
+	if err != nil {
+		t.Fatalf("ParseFormat5 returned error: %v", err)
+	}
+
+	if m.DataFormat != 0x05 {
+		t.Errorf("DataFormat: got %d want %d", m.DataFormat, 0x05)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 205 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 205)
+	}
+	if m.LocalName == nil || *m.LocalName != "Ruuvi 884" {
+		t.Errorf("LocalName: got %v want %v", m.LocalName, "Ruuvi 884")
+	}
+	if m.AdvertisementFlags == nil || *m.AdvertisementFlags != 0x1A {
+		t.Errorf("AdvertisementFlags: got %v want %v", m.AdvertisementFlags, 0x1A)
+	}
+}
@@ -0,0 +1,293 @@
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// encoder builds Ruuvi manufacturer specific data, keeping the first error that occurred
+type encoder struct {
+	data []byte
+	err  error
+}
+
+// scale scales the value and checks that it fits within the range of the field
+func (e *encoder) scale(field string, value float64, scale, offset float64, min, max int64) int64 {
+	scaled := math.Round((value - offset) * scale)
+	if math.IsNaN(scaled) || scaled < float64(min) || scaled > float64(max) {
+		if e.err == nil {
+			e.err = fmt.Errorf("%s %v is out of range", field, value)
+		}
+		return min
+	}
+	return int64(scaled)
+}
+
+// required returns the value of a field that has no "not available" marker in the format
+func (e *encoder) required(field string, value *float64) float64 {
+	if value == nil {
+		if e.err == nil {
+			e.err = fmt.Errorf("%s is required", field)
+		}
+		return 0
+	}
+	return *value
+}
+
+func (e *encoder) putUint8(value uint8) {
+	e.data = append(e.data, value)
+}
+
+func (e *encoder) putUint16(value uint16) {
+	e.data = binary.BigEndian.AppendUint16(e.data, value)
+}
+
+func (e *encoder) putUint24(value uint32) {
+	e.data = append(e.data, byte(value>>16), byte(value>>8), byte(value))
+}
+
+// putInt16 writes a signed value, or 0x8000 if the value is not available
+func (e *encoder) putInt16(field string, value *float64, scale float64) {
+	if value == nil {
+		e.putUint16(0x8000)
+		return
+	}
+	e.putUint16(uint16(e.scale(field, *value, scale, 0, math.MinInt16+1, math.MaxInt16)))
+}
+
+// putUnsigned16 writes an unsigned value, or 0xFFFF if the value is not available
+func (e *encoder) putUnsigned16(field string, value *float64, scale, offset float64, max int64) {
+	if value == nil {
+		e.putUint16(0xffff)
+		return
+	}
+	e.putUint16(uint16(e.scale(field, *value, scale, offset, 0, max)))
+}
+
+// nineBit returns a 9-bit value, or 0x1FF if the value is not available
+func (e *encoder) nineBit(field string, value *float64, scale, offset float64) uint16 {
+	if value == nil {
+		return 0x1ff
+	}
+	return uint16(e.scale(field, *value, scale, offset, 0, 0x1fe))
+}
+
+// putMac writes the last n bytes of the embedded mac address, falling back to the reported mac address, or 0xFF
+// bytes if neither is available
+func (e *encoder) putMac(m Measurement, n int) {
+	mac := m.Mac
+	if m.EmbeddedMac != nil {
+		mac = *m.EmbeddedMac
+	}
+	if mac == "" {
+		for i := 0; i < n; i++ {
+			e.putUint8(0xff)
+		}
+		return
+	}
+	decoded, err := hex.DecodeString(strings.ReplaceAll(mac, ":", ""))
+	if err != nil || len(decoded) < n {
+		if e.err == nil {
+			e.err = fmt.Errorf("invalid mac address %s", mac)
+		}
+		decoded = make([]byte, n)
+	}
+	e.data = append(e.data, decoded[len(decoded)-n:]...)
+}
+
+// advertisement wraps the manufacturer specific data into an advertisement with the flags and Ruuvi company identifier
+func (e *encoder) advertisement() (string, error) {
+	if e.err != nil {
+		return "", e.err
+	}
+	adv := make([]byte, 0, len(e.data)+7)
+	adv = append(adv, 0x02, adTypeFlags, 0x06)
+	adv = append(adv, byte(len(e.data)+3), adTypeManufacturerData)
+	adv = binary.LittleEndian.AppendUint16(adv, ruuviCompanyIdentifier)
+	adv = append(adv, e.data...)
+	return strings.ToUpper(hex.EncodeToString(adv)), nil
+}
+
+// Encode encodes the measurement into hex encoded advertisement data in the data format of the measurement
+func Encode(m Measurement) (string, error) {
+	switch m.DataFormat {
+	case 0x03:
+		return EncodeFormat3(m)
+	case 0x05:
+		return EncodeFormat5(m)
+	case 0x06:
+		return EncodeFormat6(m)
+	case 0xe1:
+		return EncodeFormatE1(m)
+	default:
+		return "", fmt.Errorf("encoding data format %X is not supported", m.DataFormat)
+	}
+}
+
+// EncodeFormat3 encodes the measurement into hex encoded advertisement data in data format 3.
+// Data format 3 has no "not available" values, so all of its values are required
+func EncodeFormat3(m Measurement) (string, error) {
+	e := encoder{data: []byte{0x03}}
+	e.putUint8(uint8(e.scale("humidity", e.required("humidity", m.Humidity), 2, 0, 0, 0xff)))
+
+	temperature := e.required("temperature", m.Temperature)
+	centidegrees := e.scale("temperature", math.Abs(temperature), 100, 0, 0, 127*100+99)
+	sign := uint8(0)
+	if temperature < 0 && centidegrees != 0 {
+		sign = 0x80
+	}
+	e.putUint8(sign | uint8(centidegrees/100))
+	e.putUint8(uint8(centidegrees % 100))
+
+	e.putUint16(uint16(e.scale("pressure", e.required("pressure", m.Pressure), 1, 50_000, 0, 0xffff)))
+	e.putUint16(uint16(e.scale("accelerationX", e.required("accelerationX", m.AccelerationX), 1000, 0, math.MinInt16, math.MaxInt16)))
+	e.putUint16(uint16(e.scale("accelerationY", e.required("accelerationY", m.AccelerationY), 1000, 0, math.MinInt16, math.MaxInt16)))
+	e.putUint16(uint16(e.scale("accelerationZ", e.required("accelerationZ", m.AccelerationZ), 1000, 0, math.MinInt16, math.MaxInt16)))
+	e.putUint16(uint16(e.scale("batteryVoltage", e.required("batteryVoltage", m.BatteryVoltage), 1000, 0, 0, 0xffff)))
+	return e.advertisement()
+}
+
+// EncodeFormat5 encodes the measurement into hex encoded advertisement data in data format 5.
+// Battery voltage and TX power share a field, so they are only "not available" when both of them are
+func EncodeFormat5(m Measurement) (string, error) {
+	e := encoder{data: []byte{0x05}}
+	e.putInt16("temperature", m.Temperature, 200)
+	e.putUnsigned16("humidity", m.Humidity, 400, 0, 40_000)
+	e.putUnsigned16("pressure", m.Pressure, 1, 50_000, 0xfffe)
+	e.putInt16("accelerationX", m.AccelerationX, 1000)
+	e.putInt16("accelerationY", m.AccelerationY, 1000)
+	e.putInt16("accelerationZ", m.AccelerationZ, 1000)
+
+	if m.BatteryVoltage == nil && m.TxPower == nil {
+		e.putUint16(0xffff)
+	} else {
+		battery := int64(0x7ff)
+		if m.BatteryVoltage != nil {
+			battery = e.scale("batteryVoltage", *m.BatteryVoltage, 1000, 1.6, 0, 0x7fe)
+		}
+		txPower := int64(0x1f)
+		if m.TxPower != nil {
+			txPower = e.scale("txPower", float64(*m.TxPower), 0.5, -40, 0, 0x1e)
+		}
+		e.putUint16(uint16(battery<<5 | txPower))
+	}
+
+	if m.MovementCounter == nil {
+		e.putUint8(0xff)
+	} else {
+		e.putUint8(uint8(e.scale("movementCounter", float64(*m.MovementCounter), 1, 0, 0, 0xfe)))
+	}
+	if m.MeasurementSequenceNumber == nil {
+		e.putUint16(0xffff)
+	} else {
+		e.putUint16(uint16(e.scale("measurementSequenceNumber", float64(*m.MeasurementSequenceNumber), 1, 0, 0, 0xfffe)))
+	}
+	e.putMac(m, 6)
+	return e.advertisement()
+}
+
+// encodeLuminosity encodes illuminance into the logarithmic luminosity code of data format 6
+func encodeLuminosity(lux float64) float64 {
+	const maxValue = 65535.0
+	const maxCode = 254.0
+	delta := math.Log(maxValue+1) / maxCode
+	return math.Log(lux+1) / delta
+}
+
+// EncodeFormat6 encodes the measurement into hex encoded advertisement data in data format 6.
+// Only the least significant byte of the measurement sequence number is included
+func EncodeFormat6(m Measurement) (string, error) {
+	e := encoder{data: []byte{0x06}}
+	e.putInt16("temperature", m.Temperature, 200)
+	e.putUnsigned16("humidity", m.Humidity, 400, 0, 40_000)
+	e.putUnsigned16("pressure", m.Pressure, 1, 50_000, 0xfffe)
+	e.putUnsigned16("pm2p5", m.Pm2p5, 10, 0, 10_000)
+	e.putUnsigned16("co2", m.CO2, 1, 0, 40_000)
+
+	voc := e.nineBit("voc", m.VOC, 1, 0)
+	nox := e.nineBit("nox", m.NOX, 1, 0)
+	e.putUint8(uint8(voc >> 1))
+	e.putUint8(uint8(nox >> 1))
+
+	if m.Illuminance == nil {
+		e.putUint8(0xff)
+	} else {
+		e.putUint8(uint8(e.scale("illuminance", encodeLuminosity(*m.Illuminance), 1, 0, 0, 0xfe)))
+	}
+	e.putUint8(0xff) // reserved
+	sequence := uint8(0)
+	if m.MeasurementSequenceNumber != nil {
+		sequence = uint8(*m.MeasurementSequenceNumber)
+	}
+	e.putUint8(sequence)
+	e.putUint8(diagnosticFlags(m) | uint8(voc&1)<<6 | uint8(nox&1)<<7)
+	e.putMac(m, 3)
+	return e.advertisement()
+}
+
+// diagnosticFlags returns the calibration, button and RTC flags shared by data formats 6 and E1
+func diagnosticFlags(m Measurement) uint8 {
+	var flags uint8
+	if m.CalibrationInProgress != nil && *m.CalibrationInProgress {
+		flags |= 0x01
+	}
+	if m.ButtonPressedOnBoot != nil && *m.ButtonPressedOnBoot {
+		flags |= 0x02
+	}
+	if m.RtcOnBoot != nil && *m.RtcOnBoot {
+		flags |= 0x04
+	}
+	return flags
+}
+
+// EncodeFormatE1 encodes the measurement into hex encoded advertisement data in data format E1
+func EncodeFormatE1(m Measurement) (string, error) {
+	e := encoder{data: []byte{0xe1}}
+	e.putInt16("temperature", m.Temperature, 200)
+	e.putUnsigned16("humidity", m.Humidity, 400, 0, 40_000)
+	e.putUnsigned16("pressure", m.Pressure, 1, 50_000, 0xfffe)
+	e.putUnsigned16("pm1p0", m.Pm1p0, 10, 0, 10_000)
+	e.putUnsigned16("pm2p5", m.Pm2p5, 10, 0, 10_000)
+	e.putUnsigned16("pm4p0", m.Pm4p0, 10, 0, 10_000)
+	e.putUnsigned16("pm10p0", m.Pm10p0, 10, 0, 10_000)
+	e.putUnsigned16("co2", m.CO2, 1, 0, 40_000)
+
+	voc := e.nineBit("voc", m.VOC, 1, 0)
+	nox := e.nineBit("nox", m.NOX, 1, 0)
+	e.putUint8(uint8(voc >> 1))
+	e.putUint8(uint8(nox >> 1))
+
+	if m.Illuminance == nil {
+		e.putUint24(0xffffff)
+	} else {
+		e.putUint24(uint32(e.scale("illuminance", *m.Illuminance, 100, 0, 0, 0xfffffe)))
+	}
+
+	soundInstant := e.nineBit("soundInstant", m.SoundInstant, 5, 18)
+	soundAverage := e.nineBit("soundAverage", m.SoundAverage, 5, 18)
+	soundPeak := e.nineBit("soundPeak", m.SoundPeak, 5, 18)
+	e.putUint8(uint8(soundInstant >> 1))
+	e.putUint8(uint8(soundAverage >> 1))
+	e.putUint8(uint8(soundPeak >> 1))
+
+	if m.MeasurementSequenceNumber == nil {
+		e.putUint24(0xffffff)
+	} else {
+		e.putUint24(uint32(e.scale("measurementSequenceNumber", float64(*m.MeasurementSequenceNumber), 1, 0, 0, 0xfffffe)))
+	}
+
+	e.putUint8(diagnosticFlags(m) |
+		uint8(soundInstant&1)<<3 |
+		uint8(soundAverage&1)<<4 |
+		uint8(soundPeak&1)<<5 |
+		uint8(voc&1)<<6 |
+		uint8(nox&1)<<7)
+	for i := 0; i < 5; i++ {
+		e.putUint8(0xff) // reserved
+	}
+	e.putMac(m, 6)
+	return e.advertisement()
+}
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+var encoderTestPayloads = []struct {
+	name    string
+	decode  Decoder
+	payload []byte
+}{
+	{"format 3", decodeFormat3, []byte{
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC, 0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	}},
+	{"format 3 negative temperature", decodeFormat3, []byte{
+		0x03, 0x29, 0x9A, 0x1E, 0xCE, 0x1E, 0xFC, 0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	}},
+	{"format 5", decodeFormat5, []byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}},
+	{"format 5 not available", decodeFormat5, []byte{
+		0x05, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x80,
+		0x00, 0x80, 0x00, 0x80, 0x00, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	}},
+	{"format 6", decodeFormat6, []byte{
+		0x06, 0x17, 0x0C, 0x56, 0x68, 0xC7, 0x9E, 0x00, 0x70, 0x00,
+		0xC9, 0x05, 0x01, 0xD9, 0xFF, 0xCD, 0x40, 0x4C, 0x88, 0x4F,
+	}},
+	{"format 6 not available", decodeFormat6, []byte{
+		0x06, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0xC0, 0xFF, 0xFF, 0xFF,
+	}},
+	{"format E1", decodeFormatE1, []byte{
+		0xE1, 0x17, 0x0C, 0x56, 0x68, 0xC7, 0x9E, 0x00, 0x65, 0x00,
+		0x70, 0x04, 0xBD, 0x11, 0xCA, 0x00, 0xC9, 0x05, 0x01, 0x13,
+		0xE0, 0xAC, 0x3D, 0x4A, 0xFE, 0x00, 0xCD, 0x01, 0x0D, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}},
+	{"format E1 not available", decodeFormatE1, []byte{
+		0xE1, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF8, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	}},
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	for _, test := range encoderTestPayloads {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := test.decode(test.payload)
+			if err != nil {
+				t.Fatalf("decoding returned error: %v", err)
+			}
+
+			encoded, err := Encode(expected)
+			if err != nil {
+				t.Fatalf("Encode returned error: %v", err)
+			}
+			adv, err := hex.DecodeString(encoded)
+			if err != nil {
+				t.Fatalf("Encode returned invalid hex: %v", err)
+			}
+			if !bytes.HasSuffix(adv, test.payload) {
+				t.Errorf("payload: got %X want %X", adv, test.payload)
+			}
+
+			m, ok := Parse(encoded)
+			if !ok {
+				t.Fatalf("Parse failed for encoded data %s", encoded)
+			}
+			if m.AdvertisementFlags == nil || *m.AdvertisementFlags != 0x06 {
+				t.Errorf("AdvertisementFlags: got %v want %v", m.AdvertisementFlags, 0x06)
+			}
+			m.DataFormatName = ""
+			m.PayloadHash = 0
+			m.AdvertisementData = AdvertisementData{}
+			if !reflect.DeepEqual(m, expected) {
+				t.Errorf("decoded measurement: got %+v want %+v", m, expected)
+			}
+		})
+	}
+}
+
+func TestEncodeFormat5_Values(t *testing.T) {
+	var m Measurement
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.DataFormat = 5
+	m.Temperature = f64(-12.345)
+	m.Humidity = f64(45.67)
+	m.Pressure = f64(100_123)
+	m.AccelerationX = f64(-1.5)
+	m.AccelerationY = f64(0.25)
+	m.AccelerationZ = f64(1)
+	m.BatteryVoltage = f64(2.987)
+	m.TxPower = i64(4)
+	m.MovementCounter = i64(12)
+	m.MeasurementSequenceNumber = i64(65534)
+
+	encoded, err := EncodeFormat5(m)
+	if err != nil {
+		t.Fatalf("EncodeFormat5 returned error: %v", err)
+	}
+	decoded, err := ParseFormat5(encoded)
+	if err != nil {
+		t.Fatalf("ParseFormat5 returned error: %v", err)
+	}
+
+	floats := []struct {
+		name       string
+		got, want  *float64
+		resolution float64
+	}{
+		{"Temperature", decoded.Temperature, m.Temperature, 0.005},
+		{"Humidity", decoded.Humidity, m.Humidity, 0.0025},
+		{"Pressure", decoded.Pressure, m.Pressure, 1},
+		{"AccelerationX", decoded.AccelerationX, m.AccelerationX, 0.001},
+		{"AccelerationY", decoded.AccelerationY, m.AccelerationY, 0.001},
+		{"AccelerationZ", decoded.AccelerationZ, m.AccelerationZ, 0.001},
+		{"BatteryVoltage", decoded.BatteryVoltage, m.BatteryVoltage, 0.001},
+	}
+	for _, f := range floats {
+		if f.got == nil || math.Abs(*f.got-*f.want) > f.resolution/2+1e-9 {
+			t.Errorf("%s: got %v want %v", f.name, f.got, *f.want)
+		}
+	}
+	if decoded.TxPower == nil || *decoded.TxPower != 4 {
+		t.Errorf("TxPower: got %v want %v", decoded.TxPower, 4)
+	}
+	if decoded.MovementCounter == nil || *decoded.MovementCounter != 12 {
+		t.Errorf("MovementCounter: got %v want %v", decoded.MovementCounter, 12)
+	}
+	if decoded.MeasurementSequenceNumber == nil || *decoded.MeasurementSequenceNumber != 65534 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", decoded.MeasurementSequenceNumber, 65534)
+	}
+	if decoded.EmbeddedMac == nil || *decoded.EmbeddedMac != m.Mac {
+		t.Errorf("EmbeddedMac: got %v want %v", decoded.EmbeddedMac, m.Mac)
+	}
+}
+
+func TestEncode_Errors(t *testing.T) {
+	var outOfRange Measurement
+	outOfRange.DataFormat = 5
+	outOfRange.Humidity = f64(101)
+	if _, err := Encode(outOfRange); err == nil {
+		t.Errorf("expected error for out of range humidity")
+	}
+
+	var missing Measurement
+	missing.DataFormat = 3
+	missing.Humidity = f64(50)
+	if _, err := Encode(missing); err == nil {
+		t.Errorf("expected error for missing values in data format 3")
+	}
+
+	var invalidMac Measurement
+	invalidMac.DataFormat = 5
+	invalidMac.Mac = "not a mac"
+	if _, err := Encode(invalidMac); err == nil {
+		t.Errorf("expected error for invalid mac address")
+	}
+
+	var unsupported Measurement
+	unsupported.DataFormat = 8
+	if _, err := Encode(unsupported); err == nil {
+		t.Errorf("expected error for unsupported data format")
+	}
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseErrorReason describes why parsing the data failed
+type ParseErrorReason int
+
+const (
+	ReasonInvalidHex             ParseErrorReason = iota // input is not valid hex
+	ReasonMalformedAdvertisement                         // AD structures of the advertisement are malformed
+	ReasonUnknownFormat                                  // no registered decoder matches the data
+	ReasonTooShort                                       // data is too short for the format
+	ReasonWrongFormat                                    // data is not in the expected format
+	ReasonInvalidValue                                   // a field contains a value that cannot be decoded
+	ReasonNoKey                                          // data is encrypted and no key is configured for the tag
+	ReasonInvalidChecksum                                // checksum does not match, for encrypted data usually a wrong key
+)
+
+// String returns the reason in a form suitable for logs and metric labels
+func (r ParseErrorReason) String() string {
+	switch r {
+	case ReasonInvalidHex:
+		return "invalid_hex"
+	case ReasonMalformedAdvertisement:
+		return "malformed_advertisement"
+	case ReasonUnknownFormat:
+		return "unknown_format"
+	case ReasonTooShort:
+		return "too_short"
+	case ReasonWrongFormat:
+		return "wrong_format"
+	case ReasonInvalidValue:
+		return "invalid_value"
+	case ReasonNoKey:
+		return "no_key"
+	case ReasonInvalidChecksum:
+		return "invalid_checksum"
+	default:
+		return fmt.Sprintf("unknown_reason_%d", int(r))
+	}
+}
+
+// ParseError is the error returned when parsing data fails
+type ParseError struct {
+	Format string           // Attempted data format, empty if the format could not be determined
+	Reason ParseErrorReason // Why the parsing failed
+	Field  string           // Field that could not be decoded, empty if the failure is not specific to a field
+	Offset int              // Byte offset in Raw where the failure was detected
+	Raw    []byte           // Raw advertisement data. If the input is not valid hex, the input text and Offset is the character offset
+	Err    error            // Human readable description of the failure
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.Format != "" {
+		fmt.Fprintf(&b, "format %s: ", e.Format)
+	}
+	b.WriteString(e.Err.Error())
+	if e.Field != "" {
+		fmt.Fprintf(&b, " (field %s)", e.Field)
+	}
+	fmt.Fprintf(&b, " at offset %d", e.Offset)
+	return b.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError returns a ParseError with the offset relative to the data being decoded, which is adjusted
+// to be relative to the whole advertisement by asParseError
+func newParseError(reason ParseErrorReason, offset int, field string, message string) *ParseError {
+	return &ParseError{Reason: reason, Field: field, Offset: offset, Err: errors.New(message)}
+}
+
+// offsetOf returns the offset of sub in data. Sub must be a subslice of data
+func offsetOf(data, sub []byte) int {
+	return cap(data) - cap(sub)
+}
+
+// asParseError converts the error returned by a decoder of the given format into a ParseError relative to the
+// whole advertisement, given the data passed to the decoder
+func asParseError(err error, format string, raw, data []byte) *ParseError {
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		parseErr = &ParseError{Reason: ReasonInvalidValue, Err: err}
+	}
+	if parseErr.Format == "" {
+		parseErr.Format = format
+	}
+	if parseErr.Raw == nil {
+		parseErr.Offset += offsetOf(raw, data)
+		parseErr.Raw = raw
+	}
+	return parseErr
+}
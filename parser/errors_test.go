@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecode_ParseError(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+		reason ParseErrorReason
+		field  string
+		offset int
+	}{
+		{"invalid hex", "020106zz", "", ReasonInvalidHex, "", 6},
+		{"odd length", "0201060", "", ReasonInvalidHex, "", 7},
+		{"unknown format", "02010603FF3412", "", ReasonUnknownFormat, "", 0},
+		{"malformed", "0201061FFF9904", "", ReasonMalformedAdvertisement, "", 3},
+		{"format 5 too short", "0201060CFF99040512FC5394C37C0004", "5", ReasonTooShort, "", 16},
+		{"format 2 invalid url", "0201060303AAFE1616AAFE10F903" + "7275752e76692f23" + "2a2a2a2a2a2a2a2a", "2", ReasonInvalidValue, "url", 22},
+		{"format 8 no key", "0201061BFF990408" + strings.Repeat("00", 17) + "0102030405FF", "8", ReasonNoKey, "mac", 25},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(test.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Format != test.format {
+				t.Errorf("Format: got %q want %q", parseErr.Format, test.format)
+			}
+			if parseErr.Reason != test.reason {
+				t.Errorf("Reason: got %v want %v", parseErr.Reason, test.reason)
+			}
+			if parseErr.Field != test.field {
+				t.Errorf("Field: got %q want %q", parseErr.Field, test.field)
+			}
+			if parseErr.Offset != test.offset {
+				t.Errorf("Offset: got %d want %d", parseErr.Offset, test.offset)
+			}
+			if parseErr.Raw == nil {
+				t.Errorf("Raw: expected the raw data")
+			}
+		})
+	}
+}
+
+func TestParseFormat5_ParseError(t *testing.T) {
+	_, err := ParseFormat5("0201061BFF990406" + strings.Repeat("00", 23))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if parseErr.Format != "5" || parseErr.Reason != ReasonWrongFormat || parseErr.Offset != 7 {
+		t.Errorf("got %+v", parseErr)
+	}
+	if err.Error() != "format 5: data is not in data format 5 at offset 7" {
+		t.Errorf("Error: got %q", err.Error())
+	}
+}
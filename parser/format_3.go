@@ -2,34 +2,25 @@ package parser
 
 import (
 	"encoding/binary"
-	"encoding/hex"
-	"errors"
-
-	"github.com/rs/zerolog/log"
 )
 
-func ParseFormat3(input string) (Measurement, error) {
-	var m Measurement
-	data, err := hex.DecodeString(input)
-	if err != nil {
-		return m, err
-	}
-	if len(data) < 21 {
-		return m, errors.New("data is too short")
-	}
+func init() {
+	RegisterDecoder(ruuviCompanyIdentifier, 0x03, "3", decodeFormat3)
+}
 
-	if data[4] != 0xff { // manufacturer specific data
-		return m, errors.New("data is not manufacturer specific data")
-	}
+func ParseFormat3(input string) (Measurement, error) {
+	return parseRuuviFormat(input, 4, "3", decodeFormat3)
+}
 
-	if data[5] != ruuviCompanyIdentifier[0] || data[6] != ruuviCompanyIdentifier[1] {
-		return m, errors.New("data has wrong company identifier")
+// decodeFormat3 decodes Ruuvi manufacturer specific data in data format 3, starting from the data format byte
+func decodeFormat3(data []byte) (Measurement, error) {
+	var m Measurement
+	if len(data) < 14 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
 	}
 
-	data = data[7:]
-
 	if data[0] != 0x03 { // data format
-		return m, errors.New("data is not in data format 3")
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not in data format 3")
 	}
 
 	m.DataFormat = int64(data[0])
@@ -48,9 +39,5 @@ func ParseFormat3(input string) (Measurement, error) {
 	m.AccelerationZ = f64(float64(int16(binary.BigEndian.Uint16(data[10:]))) / 1000)
 	m.BatteryVoltage = f64(float64(binary.BigEndian.Uint16(data[12:])) / 1000)
 
-	log.Trace().
-		Str("raw_data", input).
-		Int64("data_format", m.DataFormat).
-		Msg("Successfully parsed data")
 	return m, nil
 }
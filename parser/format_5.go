@@ -3,34 +3,25 @@ package parser
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/hex"
-	"errors"
-
-	"github.com/rs/zerolog/log"
 )
 
-func ParseFormat5(input string) (Measurement, error) {
-	var m Measurement
-	data, err := hex.DecodeString(input)
-	if err != nil {
-		return m, err
-	}
-	if len(data) < 31 {
-		return m, errors.New("data is too short")
-	}
+func init() {
+	RegisterDecoder(ruuviCompanyIdentifier, 0x05, "5", decodeFormat5)
+}
 
-	if data[4] != 0xff { // manufacturer specific data
-		return m, errors.New("data is not manufacturer specific data")
-	}
+func ParseFormat5(input string) (Measurement, error) {
+	return parseRuuviFormat(input, 4, "5", decodeFormat5)
+}
 
-	if data[5] != ruuviCompanyIdentifier[0] || data[6] != ruuviCompanyIdentifier[1] {
-		return m, errors.New("data has wrong company identifier")
+// decodeFormat5 decodes Ruuvi manufacturer specific data in data format 5, starting from the data format byte
+func decodeFormat5(data []byte) (Measurement, error) {
+	var m Measurement
+	if len(data) < 24 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
 	}
 
-	data = data[7:]
-
 	if data[0] != 0x05 { // data format
-		return m, errors.New("data is not in data format 5")
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not in data format 5")
 	}
 
 	m.DataFormat = int64(data[0])
@@ -63,10 +54,7 @@ func ParseFormat5(input string) (Measurement, error) {
 	if !bytes.Equal(data[16:18], []byte{0xff, 0xff}) {
 		m.MeasurementSequenceNumber = i64(int64(binary.BigEndian.Uint16(data[16:18])))
 	}
+	m.EmbeddedMac = formatMac(data[18:24])
 
-	log.Trace().
-		Str("raw_data", input).
-		Int64("data_format", m.DataFormat).
-		Msg("Successfully parsed data")
 	return m, nil
 }
@@ -74,6 +74,9 @@ func TestParseFormat5_OK(t *testing.T) {
 	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != expectMeas {
 		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, expectMeas)
 	}
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "CB:B8:33:4C:88:4F" {
+		t.Errorf("EmbeddedMac: got %v want %v", m.EmbeddedMac, "CB:B8:33:4C:88:4F")
+	}
 }
 
 func TestParseFormat5_Max(t *testing.T) {
@@ -222,4 +225,7 @@ func TestParseFormat5_Invalid(t *testing.T) {
 	if m.MeasurementSequenceNumber != nil {
 		t.Errorf("MeasurementSequenceNumber: expected nil, got %v", m.MeasurementSequenceNumber)
 	}
+	if m.EmbeddedMac != nil {
+		t.Errorf("EmbeddedMac: expected nil, got %v", *m.EmbeddedMac)
+	}
 }
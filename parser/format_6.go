@@ -3,35 +3,26 @@ package parser
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/hex"
-	"errors"
 	"math"
-
-	"github.com/rs/zerolog/log"
 )
 
-func ParseFormat6(input string) (Measurement, error) {
-	var m Measurement
-	data, err := hex.DecodeString(input)
-	if err != nil {
-		return m, err
-	}
-	if len(data) < 23 {
-		return m, errors.New("data is too short")
-	}
+func init() {
+	RegisterDecoder(ruuviCompanyIdentifier, 0x06, "6", decodeFormat6)
+}
 
-	if data[4] != 0xff { // manufacturer specific data
-		return m, errors.New("data is not manufacturer specific data")
-	}
+func ParseFormat6(input string) (Measurement, error) {
+	return parseRuuviFormat(input, 4, "6", decodeFormat6)
+}
 
-	if data[5] != ruuviCompanyIdentifier[0] || data[6] != ruuviCompanyIdentifier[1] {
-		return m, errors.New("data has wrong company identifier")
+// decodeFormat6 decodes Ruuvi manufacturer specific data in data format 6, starting from the data format byte
+func decodeFormat6(data []byte) (Measurement, error) {
+	var m Measurement
+	if len(data) < 17 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
 	}
 
-	data = data[7:]
-
 	if data[0] != 0x06 { // data format
-		return m, errors.New("data is not in data format 6")
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not in data format 6")
 	}
 
 	m.DataFormat = int64(data[0])
@@ -95,9 +86,10 @@ func ParseFormat6(input string) (Measurement, error) {
 	// 255 is a valid value, so we always set it
 	m.MeasurementSequenceNumber = i64(int64(data[15]))
 
-	log.Trace().
-		Str("raw_data", input).
-		Int64("data_format", m.DataFormat).
-		Msg("Successfully parsed data")
+	// MAC (offset 17-19): last 3 bytes of the MAC address
+	if len(data) >= 20 {
+		m.EmbeddedMac = formatMac(data[17:20])
+	}
+
 	return m, nil
 }
@@ -115,6 +115,11 @@ func TestParseFormat6_ValidData(t *testing.T) {
 	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != expectedSeq {
 		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, expectedSeq)
 	}
+
+	// Verify embedded MAC: last 3 bytes
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "4C:88:4F" {
+		t.Errorf("EmbeddedMac: got %v want %v", m.EmbeddedMac, "4C:88:4F")
+	}
 }
 
 func TestParseFormat6_MaximumValues(t *testing.T) {
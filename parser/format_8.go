@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxReportedTags limits how many tags without a key are remembered as reported. The embedded mac address is not
+// authenticated, so the reported tags are forgotten when the limit is reached, rather than letting spoofed packets
+// grow the map
+const maxReportedTags = 1024
+
+var encryptionKeys = struct {
+	sync.RWMutex
+	keys     map[string][]byte
+	reported map[string]bool
+}{
+	keys:     make(map[string][]byte),
+	reported: make(map[string]bool),
+}
+
+// SetEncryptionKeys sets the AES-128 keys used to decrypt data format 8, keyed by the mac address of the tag
+func SetEncryptionKeys(keys map[string][]byte) error {
+	parsed := make(map[string][]byte)
+	for mac, key := range keys {
+		if len(key) != 16 {
+			return fmt.Errorf("invalid encryption key length for %s: got %d bytes, expected 16", mac, len(key))
+		}
+		parsed[strings.ToUpper(strings.ReplaceAll(mac, ":", ""))] = key
+	}
+	encryptionKeys.Lock()
+	defer encryptionKeys.Unlock()
+	encryptionKeys.keys = parsed
+	encryptionKeys.reported = make(map[string]bool)
+	return nil
+}
+
+func encryptionKey(mac string) []byte {
+	encryptionKeys.RLock()
+	key := encryptionKeys.keys[mac]
+	encryptionKeys.RUnlock()
+	if key != nil {
+		return key
+	}
+	encryptionKeys.Lock()
+	defer encryptionKeys.Unlock()
+	if !encryptionKeys.reported[mac] {
+		if len(encryptionKeys.reported) >= maxReportedTags {
+			encryptionKeys.reported = make(map[string]bool)
+		}
+		encryptionKeys.reported[mac] = true
+		log.Warn().Str("mac", mac).Msg("Received data format 8 from a tag, but it is encrypted and no key is configured for it")
+	}
+	return nil
+}
+
+// crc8 calculates the CRC-8 (polynomial 0x07, initial value 0x00) used by data format 8
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func init() {
+	RegisterDecoder(ruuviCompanyIdentifier, 0x08, "8", decodeFormat8)
+}
+
+func ParseFormat8(input string) (Measurement, error) {
+	return parseRuuviFormat(input, 4, "8", decodeFormat8)
+}
+
+// decodeFormat8 decodes Ruuvi manufacturer specific data in data format 8, starting from the data format byte
+func decodeFormat8(data []byte) (Measurement, error) {
+	var m Measurement
+	if len(data) < 24 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
+	}
+
+	if data[0] != 0x08 { // data format
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not in data format 8")
+	}
+
+	// MAC address (offset 18-23) is not encrypted, and is used to look up the key
+	mac := strings.ToUpper(hex.EncodeToString(data[18:24]))
+	key := encryptionKey(mac)
+	if key == nil {
+		return m, newParseError(ReasonNoKey, 18, "mac", "data is encrypted, no key")
+	}
+
+	// Offset 1-16 is a single AES-128 block in ECB mode
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return m, err
+	}
+	decrypted := make([]byte, 16)
+	block.Decrypt(decrypted, data[1:17])
+
+	// CRC8 (offset 17) is calculated over the decrypted data
+	if crc8(decrypted) != data[17] {
+		return m, newParseError(ReasonInvalidChecksum, 17, "", "data has invalid checksum, wrong key?")
+	}
+
+	m.DataFormat = int64(data[0])
+	if !bytes.Equal(decrypted[0:2], []byte{0x80, 0x00}) {
+		m.Temperature = f64(float64(int16(binary.BigEndian.Uint16(decrypted[0:2]))) / 200)
+	}
+	if !bytes.Equal(decrypted[2:4], []byte{0xff, 0xff}) {
+		m.Humidity = f64(float64(binary.BigEndian.Uint16(decrypted[2:4])) / 400)
+	}
+	if !bytes.Equal(decrypted[4:6], []byte{0xff, 0xff}) {
+		m.Pressure = f64(float64(binary.BigEndian.Uint16(decrypted[4:6])) + 50_000)
+	}
+	if !bytes.Equal(decrypted[6:8], []byte{0xff, 0xff}) {
+		powerInfo := binary.BigEndian.Uint16(decrypted[6:8])
+		m.BatteryVoltage = f64(float64(powerInfo>>5)/1000 + 1.6)
+		m.TxPower = i64(int64(powerInfo&0b11111)*2 - 40)
+	}
+	if !bytes.Equal(decrypted[8:10], []byte{0xff, 0xff}) {
+		m.MovementCounter = i64(int64(binary.BigEndian.Uint16(decrypted[8:10])))
+	}
+	if !bytes.Equal(decrypted[10:12], []byte{0xff, 0xff}) {
+		m.MeasurementSequenceNumber = i64(int64(binary.BigEndian.Uint16(decrypted[10:12])))
+	}
+	m.EmbeddedMac = formatMac(data[18:24])
+
+	return m, nil
+}
@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+)
+
+var testKeyFormat8 = []byte{
+	0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77,
+	0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF,
+}
+
+func buildFullAdvertisementFormat8(key []byte, plaintext []byte, mac []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	encrypted := make([]byte, 16)
+	block.Encrypt(encrypted, plaintext)
+
+	header := []byte{0x02, 0x01, 0x06, 0x1B, 0xFF, 0x99, 0x04}
+	adv := make([]byte, 0, 31)
+	adv = append(adv, header...)
+	adv = append(adv, 0x08)
+	adv = append(adv, encrypted...)
+	adv = append(adv, crc8(plaintext))
+	adv = append(adv, mac...)
+	return adv
+}
+
+func TestParseFormat8_OK(t *testing.T) {
+	if err := SetEncryptionKeys(map[string][]byte{"CB:B8:33:4C:88:4F": testKeyFormat8}); err != nil {
+		t.Fatalf("SetEncryptionKeys returned error: %v", err)
+	}
+	plaintext := []byte{
+		0x12, 0xFC, // Temperature (24.3 C)
+		0x53, 0x94, // Humidity (53.49 %)
+		0xC3, 0x7C, // Pressure (100044 Pa)
+		0xAC, 0x36, // Power info (2.977 V, 4 dBm)
+		0x00, 0x42, // Movement counter (66)
+		0x00, 0xCD, // Measurement sequence (205)
+		0xFF, 0xFF, 0xFF, 0xFF, // Reserved
+	}
+	adv := buildFullAdvertisementFormat8(testKeyFormat8, plaintext, []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F})
+	hexStr := hex.EncodeToString(adv)
+
+	m, err := ParseFormat8(hexStr)
+	if err != nil {
+		t.Fatalf("ParseFormat8 returned error: %v", err)
+	}
+
+	if m.DataFormat != 0x08 {
+		t.Errorf("DataFormat: got %d want %d", m.DataFormat, 0x08)
+	}
+	if m.Temperature == nil || int(math.Round(*m.Temperature*1000)) != 24300 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 24.3)
+	}
+	if m.Humidity == nil || int(math.Round(*m.Humidity*10000)) != 534900 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 53.49)
+	}
+	if m.Pressure == nil || *m.Pressure != 100044 {
+		t.Errorf("Pressure: got %v want %v", m.Pressure, 100044)
+	}
+	if m.BatteryVoltage == nil || int(math.Round(*m.BatteryVoltage*1000)) != 2977 {
+		t.Errorf("BatteryVoltage: got %v want %v", m.BatteryVoltage, 2.977)
+	}
+	if m.TxPower == nil || *m.TxPower != 4 {
+		t.Errorf("TxPower: got %v want %v", m.TxPower, 4)
+	}
+	if m.MovementCounter == nil || *m.MovementCounter != 66 {
+		t.Errorf("MovementCounter: got %v want %v", m.MovementCounter, 66)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 205 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 205)
+	}
+}
+
+func TestParseFormat8_Invalid(t *testing.T) {
+	if err := SetEncryptionKeys(map[string][]byte{"CBB8334C884F": testKeyFormat8}); err != nil {
+		t.Fatalf("SetEncryptionKeys returned error: %v", err)
+	}
+	plaintext := []byte{
+		0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	adv := buildFullAdvertisementFormat8(testKeyFormat8, plaintext, []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F})
+	hexStr := hex.EncodeToString(adv)
+
+	m, err := ParseFormat8(hexStr)
+	if err != nil {
+		t.Fatalf("ParseFormat8 returned error: %v", err)
+	}
+
+	if m.Temperature != nil || m.Humidity != nil || m.Pressure != nil {
+		t.Errorf("Environmental fields: expected nils, got T=%v H=%v P=%v", m.Temperature, m.Humidity, m.Pressure)
+	}
+	if m.BatteryVoltage != nil || m.TxPower != nil {
+		t.Errorf("Power fields: expected nils, got Battery=%v TxPower=%v", m.BatteryVoltage, m.TxPower)
+	}
+	if m.MovementCounter != nil || m.MeasurementSequenceNumber != nil {
+		t.Errorf("Counters: expected nils, got Movement=%v Sequence=%v", m.MovementCounter, m.MeasurementSequenceNumber)
+	}
+}
+
+// The known answer vector is written out by hand rather than built with the test helpers: the AES-128 key, plaintext
+// and ciphertext are the example vector of FIPS-197 appendix C.1, and the CRC is CRC-8/SMBUS (polynomial 0x07,
+// initial value 0x00) of the plaintext
+var (
+	knownAnswerKeyFormat8 = "000102030405060708090a0b0c0d0e0f"
+	knownAnswerFormat8    = "0201061bff9904" + "08" + "69c4e0d86a7b0430d8cdb78070b4c55a" + "4d" + "cbb8334c884f"
+)
+
+func TestCrc8_CheckValue(t *testing.T) {
+	// the check value of CRC-8/SMBUS from the catalogue of parametrised CRC algorithms
+	if crc := crc8([]byte("123456789")); crc != 0xf4 {
+		t.Errorf("crc8: got %02x want f4", crc)
+	}
+}
+
+func TestParseFormat8_KnownAnswer(t *testing.T) {
+	key, _ := hex.DecodeString(knownAnswerKeyFormat8)
+	if err := SetEncryptionKeys(map[string][]byte{"CBB8334C884F": key}); err != nil {
+		t.Fatalf("SetEncryptionKeys returned error: %v", err)
+	}
+	defer SetEncryptionKeys(nil)
+
+	m, err := ParseFormat8(knownAnswerFormat8)
+	if err != nil {
+		t.Fatalf("ParseFormat8 returned error: %v", err)
+	}
+	// plaintext 0011 2233 4455 6677 8899 aabb ccddeeff
+	checkFloat := func(name string, got *float64, want float64) {
+		if got == nil || math.Abs(*got-want) > 1e-9 {
+			t.Errorf("%s: got %v want %v", name, got, want)
+		}
+	}
+	checkFloat("Temperature", m.Temperature, 0.085)
+	checkFloat("Humidity", m.Humidity, 21.8875)
+	checkFloat("Pressure", m.Pressure, 67493)
+	checkFloat("BatteryVoltage", m.BatteryVoltage, 2.419)
+	if m.TxPower == nil || *m.TxPower != 6 {
+		t.Errorf("TxPower: got %v want 6", m.TxPower)
+	}
+	if m.MovementCounter == nil || *m.MovementCounter != 34969 {
+		t.Errorf("MovementCounter: got %v want 34969", m.MovementCounter)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 43707 {
+		t.Errorf("MeasurementSequenceNumber: got %v want 43707", m.MeasurementSequenceNumber)
+	}
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "CB:B8:33:4C:88:4F" {
+		t.Errorf("EmbeddedMac: got %v want CB:B8:33:4C:88:4F", m.EmbeddedMac)
+	}
+}
+
+func TestParseFormat8_KnownAnswerInvalid(t *testing.T) {
+	key, _ := hex.DecodeString(knownAnswerKeyFormat8)
+	wrongKey, _ := hex.DecodeString(knownAnswerKeyFormat8)
+	wrongKey[15] ^= 0x01
+	tests := []struct {
+		name  string
+		key   []byte
+		input string
+	}{
+		{"wrong key", wrongKey, knownAnswerFormat8},
+		{"wrong crc", key, knownAnswerFormat8[:len(knownAnswerFormat8)-14] + "4c" + "cbb8334c884f"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := SetEncryptionKeys(map[string][]byte{"CBB8334C884F": test.key}); err != nil {
+				t.Fatalf("SetEncryptionKeys returned error: %v", err)
+			}
+			defer SetEncryptionKeys(nil)
+			_, err := ParseFormat8(test.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Reason != ReasonInvalidChecksum {
+				t.Errorf("expected an invalid checksum, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseFormat8_NoKey(t *testing.T) {
+	if err := SetEncryptionKeys(nil); err != nil {
+		t.Fatalf("SetEncryptionKeys returned error: %v", err)
+	}
+	plaintext := make([]byte, 16)
+	adv := buildFullAdvertisementFormat8(testKeyFormat8, plaintext, []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F})
+
+	if _, err := ParseFormat8(hex.EncodeToString(adv)); err == nil {
+		t.Errorf("ParseFormat8: expected error without a key")
+	}
+}
+
+func TestParseFormat8_NoKeyReportedLimit(t *testing.T) {
+	if err := SetEncryptionKeys(nil); err != nil {
+		t.Fatalf("SetEncryptionKeys returned error: %v", err)
+	}
+	plaintext := make([]byte, 16)
+	for i := range maxReportedTags + 10 {
+		adv := buildFullAdvertisementFormat8(testKeyFormat8, plaintext, []byte{0xCB, 0xB8, 0x33, 0x4C, byte(i >> 8), byte(i)})
+		ParseFormat8(hex.EncodeToString(adv))
+	}
+	encryptionKeys.RLock()
+	reported := len(encryptionKeys.reported)
+	encryptionKeys.RUnlock()
+	if reported > maxReportedTags {
+		t.Errorf("expected at most %d reported tags, got %d", maxReportedTags, reported)
+	}
+}
+
+func TestParseFormat8_WrongKey(t *testing.T) {
+	wrongKey := make([]byte, 16)
+	if err := SetEncryptionKeys(map[string][]byte{"CBB8334C884F": wrongKey}); err != nil {
+		t.Fatalf("SetEncryptionKeys returned error: %v", err)
+	}
+	plaintext := []byte{
+		0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0xAC, 0x36,
+		0x00, 0x42, 0x00, 0xCD, 0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	adv := buildFullAdvertisementFormat8(testKeyFormat8, plaintext, []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F})
+
+	if _, err := ParseFormat8(hex.EncodeToString(adv)); err == nil {
+		t.Errorf("ParseFormat8: expected checksum error with a wrong key")
+	}
+}
+
+func TestSetEncryptionKeys_InvalidLength(t *testing.T) {
+	if err := SetEncryptionKeys(map[string][]byte{"CBB8334C884F": {0x00, 0x11}}); err == nil {
+		t.Errorf("SetEncryptionKeys: expected error for a short key")
+	}
+}
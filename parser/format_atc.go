@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// Custom formats of the ATC1441 and pvvx firmwares for Xiaomi thermometers, such as LYWSD03MMC, see
+// https://github.com/atc1441/ATC_MiThermometer and https://github.com/pvvx/ATC_MiThermometer
+const environmentalSensingServiceUUID = 0x181a
+
+func init() {
+	RegisterServiceDataDecoder(environmentalSensingServiceUUID, decodeATC, "ATC1441", "PVVX")
+}
+
+// decodeATC decodes the ATC1441 or pvvx custom format, which are distinguished by their length
+func decodeATC(data []byte) (Measurement, error) {
+	switch len(data) {
+	case 13:
+		return decodeATC1441(data), nil
+	case 15:
+		return decodePVVX(data), nil
+	default:
+		return Measurement{}, newParseError(ReasonWrongFormat, 0, "", "data is not in ATC1441 or pvvx custom format")
+	}
+}
+
+// decodeATC1441 decodes the ATC1441 format, in which all values are big endian
+func decodeATC1441(data []byte) Measurement {
+	var m Measurement
+	m.DataFormatName = "ATC1441"
+	m.EmbeddedMac = formatMac(data[0:6])
+	m.Temperature = f64(float64(int16(binary.BigEndian.Uint16(data[6:8]))) / 10)
+	m.Humidity = f64(float64(data[8]))
+	m.BatteryLevel = f64(float64(data[9]))
+	m.BatteryVoltage = f64(float64(binary.BigEndian.Uint16(data[10:12])) / 1000)
+	m.MeasurementSequenceNumber = i64(int64(data[12]))
+	return m
+}
+
+// decodePVVX decodes the pvvx custom format, in which all values are little endian, including the mac address
+func decodePVVX(data []byte) Measurement {
+	var m Measurement
+	m.DataFormatName = "PVVX"
+	mac := slices.Clone(data[0:6])
+	slices.Reverse(mac)
+	m.EmbeddedMac = formatMac(mac)
+	m.Temperature = f64(float64(int16(binary.LittleEndian.Uint16(data[6:8]))) / 100)
+	m.Humidity = f64(float64(binary.LittleEndian.Uint16(data[8:10])) / 100)
+	m.BatteryVoltage = f64(float64(binary.LittleEndian.Uint16(data[10:12])) / 1000)
+	m.BatteryLevel = f64(float64(data[12]))
+	m.MeasurementSequenceNumber = i64(int64(data[13]))
+	return m
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+func buildFullAdvertisementATC(serviceData []byte) []byte {
+	adv := []byte{0x02, 0x01, 0x06, byte(len(serviceData) + 3), 0x16, 0x1A, 0x18}
+	return append(adv, serviceData...)
+}
+
+func TestParseATC1441_OK(t *testing.T) {
+	adv := buildFullAdvertisementATC([]byte{
+		0xA4, 0xC1, 0x38, 0x01, 0x02, 0x03, // MAC
+		0x00, 0xEB, // Temperature (23.5 C)
+		0x2D,       // Humidity (45 %)
+		0x55,       // Battery (85 %)
+		0x0B, 0x7C, // Battery (2940 mV)
+		0x11, // Counter (17)
+	})
+	m, ok := Parse(hex.EncodeToString(adv))
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+
+	if m.FormatName() != "ATC1441" {
+		t.Errorf("FormatName: got %s want %s", m.FormatName(), "ATC1441")
+	}
+	if m.Temperature == nil || math.Round(*m.Temperature*10) != 235 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 23.5)
+	}
+	if m.Humidity == nil || *m.Humidity != 45 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 45)
+	}
+	if m.BatteryLevel == nil || *m.BatteryLevel != 85 {
+		t.Errorf("BatteryLevel: got %v want %v", m.BatteryLevel, 85)
+	}
+	if m.BatteryVoltage == nil || math.Round(*m.BatteryVoltage*1000) != 2940 {
+		t.Errorf("BatteryVoltage: got %v want %v", m.BatteryVoltage, 2.94)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 17 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 17)
+	}
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "A4:C1:38:01:02:03" {
+		t.Errorf("EmbeddedMac: got %v want %v", m.EmbeddedMac, "A4:C1:38:01:02:03")
+	}
+}
+
+func TestParsePVVX_OK(t *testing.T) {
+	adv := buildFullAdvertisementATC([]byte{
+		0x03, 0x02, 0x01, 0x38, 0xC1, 0xA4, // MAC (reversed)
+		0x7A, 0xFC, // Temperature (-9.02 C)
+		0x8D, 0x11, // Humidity (44.93 %)
+		0x7C, 0x0B, // Battery (2940 mV)
+		0x55, // Battery (85 %)
+		0xC8, // Counter (200)
+		0x04, // Flags
+	})
+	m, ok := Parse(hex.EncodeToString(adv))
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+
+	if m.FormatName() != "PVVX" {
+		t.Errorf("FormatName: got %s want %s", m.FormatName(), "PVVX")
+	}
+	if m.Temperature == nil || math.Round(*m.Temperature*100) != -902 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, -9.02)
+	}
+	if m.Humidity == nil || math.Round(*m.Humidity*100) != 4493 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 44.93)
+	}
+	if m.BatteryLevel == nil || *m.BatteryLevel != 85 {
+		t.Errorf("BatteryLevel: got %v want %v", m.BatteryLevel, 85)
+	}
+	if m.BatteryVoltage == nil || math.Round(*m.BatteryVoltage*1000) != 2940 {
+		t.Errorf("BatteryVoltage: got %v want %v", m.BatteryVoltage, 2.94)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 200 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 200)
+	}
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "A4:C1:38:01:02:03" {
+		t.Errorf("EmbeddedMac: got %v want %v", m.EmbeddedMac, "A4:C1:38:01:02:03")
+	}
+}
+
+func TestParseATC_WrongLength(t *testing.T) {
+	adv := buildFullAdvertisementATC([]byte{0xA4, 0xC1, 0x38, 0x01, 0x02, 0x03, 0x00, 0xEB})
+	if _, ok := Parse(hex.EncodeToString(adv)); ok {
+		t.Errorf("Parse: expected failure for data in an unknown layout")
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// BTHome v2, see https://bthome.io/format/
+const bthomeServiceUUID = 0xfcd2
+
+func init() {
+	RegisterServiceDataDecoder(bthomeServiceUUID, decodeBTHome, "BTHome")
+}
+
+// bthomeObject describes the size and encoding of a BTHome object
+type bthomeObject struct {
+	size    int // size of the value in bytes, 0 if the value is prefixed with its length
+	signed  bool
+	divisor float64
+	apply   func(m *Measurement, value float64)
+}
+
+func bthomeSkip(size int) bthomeObject {
+	return bthomeObject{size: size}
+}
+
+func bthomeFloat(size int, signed bool, divisor float64, field func(m *Measurement) **float64) bthomeObject {
+	return bthomeObject{size: size, signed: signed, divisor: divisor, apply: func(m *Measurement, value float64) {
+		if *field(m) == nil { // if the object is repeated, keep the first one
+			*field(m) = f64(value)
+		}
+	}}
+}
+
+func bthomeBool(field func(m *Measurement) **bool) bthomeObject {
+	return bthomeObject{size: 1, divisor: 1, apply: func(m *Measurement, value float64) {
+		if *field(m) == nil {
+			b := value != 0
+			*field(m) = &b
+		}
+	}}
+}
+
+var (
+	bthomeTemperature  = func(m *Measurement) **float64 { return &m.Temperature }
+	bthomeHumidity     = func(m *Measurement) **float64 { return &m.Humidity }
+	bthomePressure     = func(m *Measurement) **float64 { return &m.Pressure }
+	bthomeIlluminance  = func(m *Measurement) **float64 { return &m.Illuminance }
+	bthomeVoltage      = func(m *Measurement) **float64 { return &m.BatteryVoltage }
+	bthomePm2p5        = func(m *Measurement) **float64 { return &m.Pm2p5 }
+	bthomePm10p0       = func(m *Measurement) **float64 { return &m.Pm10p0 }
+	bthomeCO2          = func(m *Measurement) **float64 { return &m.CO2 }
+	bthomeBatteryLevel = func(m *Measurement) **float64 { return &m.BatteryLevel }
+	bthomeMoisture     = func(m *Measurement) **float64 { return &m.Moisture }
+	bthomeMotion       = func(m *Measurement) **bool { return &m.Motion }
+	bthomeOpening      = func(m *Measurement) **bool { return &m.Opening }
+)
+
+// bthomeObjects lists the known BTHome object IDs. All of them need to be known, even if they're not used, as the
+// size of the value is determined by the object ID
+var bthomeObjects = map[byte]bthomeObject{
+	0x00: {size: 1, divisor: 1, apply: func(m *Measurement, value float64) { m.MeasurementSequenceNumber = i64(int64(value)) }}, // packet id
+	0x01: bthomeFloat(1, false, 1, bthomeBatteryLevel),
+	0x02: bthomeFloat(2, true, 100, bthomeTemperature),
+	0x03: bthomeFloat(2, false, 100, bthomeHumidity),
+	0x04: bthomeFloat(3, false, 1, bthomePressure), // 0.01 hPa
+	0x05: bthomeFloat(3, false, 100, bthomeIlluminance),
+	0x06: bthomeSkip(2), // mass (kg)
+	0x07: bthomeSkip(2), // mass (lb)
+	0x08: bthomeSkip(2), // dew point
+	0x09: bthomeSkip(1), // count
+	0x0a: bthomeSkip(3), // energy
+	0x0b: bthomeSkip(3), // power
+	0x0c: bthomeFloat(2, false, 1000, bthomeVoltage),
+	0x0d: bthomeFloat(2, false, 1, bthomePm2p5),
+	0x0e: bthomeFloat(2, false, 1, bthomePm10p0),
+	0x0f: bthomeSkip(1), // generic boolean
+	0x10: bthomeSkip(1), // power
+	0x11: bthomeBool(bthomeOpening),
+	0x12: bthomeFloat(2, false, 1, bthomeCO2),
+	0x13: bthomeSkip(2), // tvoc
+	0x14: bthomeFloat(2, false, 100, bthomeMoisture),
+	0x15: bthomeSkip(1),             // battery low
+	0x16: bthomeSkip(1),             // battery charging
+	0x17: bthomeSkip(1),             // carbon monoxide
+	0x18: bthomeSkip(1),             // cold
+	0x19: bthomeSkip(1),             // connectivity
+	0x1a: bthomeBool(bthomeOpening), // door
+	0x1b: bthomeBool(bthomeOpening), // garage door
+	0x1c: bthomeSkip(1),             // gas
+	0x1d: bthomeSkip(1),             // heat
+	0x1e: bthomeSkip(1),             // light
+	0x1f: bthomeSkip(1),             // lock
+	0x20: bthomeSkip(1),             // moisture
+	0x21: bthomeBool(bthomeMotion),
+	0x22: bthomeSkip(1),             // moving
+	0x23: bthomeSkip(1),             // occupancy
+	0x24: bthomeSkip(1),             // plug
+	0x25: bthomeSkip(1),             // presence
+	0x26: bthomeSkip(1),             // problem
+	0x27: bthomeSkip(1),             // running
+	0x28: bthomeSkip(1),             // safety
+	0x29: bthomeSkip(1),             // smoke
+	0x2a: bthomeSkip(1),             // sound
+	0x2b: bthomeSkip(1),             // tamper
+	0x2c: bthomeSkip(1),             // vibration
+	0x2d: bthomeBool(bthomeOpening), // window
+	0x2e: bthomeFloat(1, false, 1, bthomeHumidity),
+	0x2f: bthomeFloat(1, false, 1, bthomeMoisture),
+	0x3a: bthomeSkip(1), // button
+	0x3c: bthomeSkip(2), // dimmer
+	0x3d: bthomeSkip(2), // count
+	0x3e: bthomeSkip(4), // count
+	0x3f: bthomeSkip(2), // rotation
+	0x40: bthomeSkip(2), // distance (mm)
+	0x41: bthomeSkip(2), // distance (m)
+	0x42: bthomeSkip(3), // duration
+	0x43: bthomeSkip(2), // current
+	0x44: bthomeSkip(2), // speed
+	0x45: bthomeFloat(2, true, 10, bthomeTemperature),
+	0x46: bthomeSkip(1), // UV index
+	0x47: bthomeSkip(2), // volume (L)
+	0x48: bthomeSkip(2), // volume (mL)
+	0x49: bthomeSkip(2), // volume flow rate
+	0x4a: bthomeFloat(2, false, 10, bthomeVoltage),
+	0x4b: bthomeSkip(3), // gas
+	0x4c: bthomeSkip(4), // gas
+	0x4d: bthomeSkip(4), // energy
+	0x4e: bthomeSkip(4), // volume
+	0x4f: bthomeSkip(4), // water
+	0x50: bthomeSkip(4), // timestamp
+	0x51: bthomeSkip(2), // acceleration
+	0x52: bthomeSkip(2), // gyroscope
+	0x53: bthomeSkip(0), // text
+	0x54: bthomeSkip(0), // raw
+	0x55: bthomeSkip(4), // volume storage
+	0x56: bthomeSkip(2), // conductivity
+	0x57: bthomeFloat(1, true, 1, bthomeTemperature),
+	0x58: bthomeFloat(1, true, 20.0/7, bthomeTemperature), // 0.35 °C
+	0x59: bthomeSkip(1),                                   // count
+	0x5a: bthomeSkip(2),                                   // count
+	0x5b: bthomeSkip(4),                                   // count
+	0x5c: bthomeSkip(4),                                   // power
+	0x5d: bthomeSkip(2),                                   // current
+	0x5e: bthomeSkip(2),                                   // direction
+	0x5f: bthomeSkip(2),                                   // precipitation
+	0x60: bthomeSkip(1),                                   // channel
+	0x61: bthomeSkip(2),                                   // rotational speed
+	0xf0: bthomeSkip(2),                                   // device type id
+	0xf1: bthomeSkip(4),                                   // firmware version
+	0xf2: bthomeSkip(3),                                   // firmware version
+}
+
+// bthomeValue reads a little endian integer of the given size
+func bthomeValue(data []byte, signed bool) float64 {
+	var buf [8]byte
+	copy(buf[:], data)
+	value := binary.LittleEndian.Uint64(buf[:])
+	if signed {
+		shift := 64 - 8*len(data)
+		return float64(int64(value<<shift) >> shift)
+	}
+	return float64(value)
+}
+
+// decodeBTHome decodes BTHome v2 service data, starting from the device information byte
+func decodeBTHome(data []byte) (Measurement, error) {
+	m := Measurement{CommonData: CommonData{DataFormatName: "BTHome"}}
+	if len(data) < 1 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
+	}
+	deviceInfo := data[0]
+	if version := deviceInfo >> 5; version != 2 {
+		return m, newParseError(ReasonWrongFormat, 0, "", fmt.Sprintf("unsupported BTHome version %d", version))
+	}
+	if deviceInfo&0x01 != 0 {
+		return m, newParseError(ReasonNoKey, 0, "", "data is encrypted, encrypted BTHome data is not supported")
+	}
+
+	offset := 1
+	for offset < len(data) {
+		id := data[offset]
+		object, ok := bthomeObjects[id]
+		if !ok {
+			// The size of an unknown object is unknown, so the rest of the data can't be decoded
+			break
+		}
+		valueOffset := offset + 1
+		size := object.size
+		if size == 0 { // length prefixed
+			if valueOffset >= len(data) {
+				return m, newParseError(ReasonTooShort, len(data), fmt.Sprintf("0x%02x", id), "data is too short")
+			}
+			size = int(data[valueOffset])
+			valueOffset++
+		}
+		if valueOffset+size > len(data) {
+			return m, newParseError(ReasonTooShort, len(data), fmt.Sprintf("0x%02x", id), "data is too short")
+		}
+		if object.apply != nil {
+			object.apply(&m, bthomeValue(data[valueOffset:valueOffset+size], object.signed)/object.divisor)
+		}
+		offset = valueOffset + size
+	}
+	return m, nil
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+func buildFullAdvertisementBTHome(serviceData []byte) []byte {
+	adv := []byte{0x02, 0x01, 0x06, byte(len(serviceData) + 3), 0x16, 0xD2, 0xFC}
+	return append(adv, serviceData...)
+}
+
+func TestParseBTHome_OK(t *testing.T) {
+	adv := buildFullAdvertisementBTHome([]byte{
+		0x40,       // BTHome v2, not encrypted
+		0x00, 0x2A, // packet id (42)
+		0x01, 0x5D, // battery (93 %)
+		0x02, 0xCA, 0x09, // temperature (25.06 C)
+		0x03, 0xBF, 0x13, // humidity (50.55 %)
+		0x04, 0x13, 0x8A, 0x01, // pressure (1008.83 hPa)
+		0x05, 0x13, 0x8A, 0x14, // illuminance (13460.67 lux)
+		0x0C, 0x02, 0x0C, // voltage (3.074 V)
+		0x12, 0xE2, 0x04, // CO2 (1250 ppm)
+		0x21, 0x01, // motion
+		0x2D, 0x00, // window closed
+		0x53, 0x02, 0x68, 0x69, // text ("hi")
+		0x45, 0x11, 0x01, // temperature (27.3 C), repeated, ignored
+	})
+	m, ok := Parse(hex.EncodeToString(adv))
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+
+	if m.FormatName() != "BTHome" {
+		t.Errorf("FormatName: got %s want %s", m.FormatName(), "BTHome")
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 42 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 42)
+	}
+	floats := []struct {
+		name      string
+		got       *float64
+		want      float64
+		precision float64
+	}{
+		{"BatteryLevel", m.BatteryLevel, 93, 1},
+		{"Temperature", m.Temperature, 25.06, 100},
+		{"Humidity", m.Humidity, 50.55, 100},
+		{"Pressure", m.Pressure, 100883, 1},
+		{"Illuminance", m.Illuminance, 13460.67, 100},
+		{"BatteryVoltage", m.BatteryVoltage, 3.074, 1000},
+		{"CO2", m.CO2, 1250, 1},
+	}
+	for _, f := range floats {
+		if f.got == nil || math.Round(*f.got*f.precision) != math.Round(f.want*f.precision) {
+			t.Errorf("%s: got %v want %v", f.name, f.got, f.want)
+		}
+	}
+	if m.Motion == nil || !*m.Motion {
+		t.Errorf("Motion: got %v want %v", m.Motion, true)
+	}
+	if m.Opening == nil || *m.Opening {
+		t.Errorf("Opening: got %v want %v", m.Opening, false)
+	}
+}
+
+func TestParseBTHome_NegativeTemperature(t *testing.T) {
+	adv := buildFullAdvertisementBTHome([]byte{0x40, 0x02, 0x18, 0xFC}) // -10.00 C
+	m, ok := Parse(hex.EncodeToString(adv))
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+	if m.Temperature == nil || math.Round(*m.Temperature*100) != -1000 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, -10)
+	}
+}
+
+func TestParseBTHome_UnknownObject(t *testing.T) {
+	// Decoding stops at the unknown object, keeping the values before it
+	adv := buildFullAdvertisementBTHome([]byte{0x40, 0x01, 0x64, 0xEE, 0x01, 0x02, 0x03, 0x02, 0xCA, 0x09})
+	m, ok := Parse(hex.EncodeToString(adv))
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+	if m.BatteryLevel == nil || *m.BatteryLevel != 100 {
+		t.Errorf("BatteryLevel: got %v want %v", m.BatteryLevel, 100)
+	}
+	if m.Temperature != nil {
+		t.Errorf("Temperature: expected nil, got %v", *m.Temperature)
+	}
+}
+
+func TestParseBTHome_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceData []byte
+		reason      ParseErrorReason
+	}{
+		{"encrypted", []byte{0x41, 0x02, 0xCA, 0x09}, ReasonNoKey},
+		{"version 1", []byte{0x20, 0x02, 0xCA, 0x09}, ReasonWrongFormat},
+		{"truncated", []byte{0x40, 0x02, 0xCA}, ReasonTooShort},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(hex.EncodeToString(buildFullAdvertisementBTHome(test.serviceData)))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Reason != test.reason || parseErr.Format != "BTHome" {
+				t.Errorf("got %+v", parseErr)
+			}
+		})
+	}
+}
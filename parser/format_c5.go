@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+func init() {
+	RegisterDecoder(ruuviCompanyIdentifier, 0xc5, "C5", decodeFormatC5)
+}
+
+func ParseFormatC5(input string) (Measurement, error) {
+	return parseRuuviFormat(input, 4, "C5", decodeFormatC5)
+}
+
+// decodeFormatC5 decodes Ruuvi manufacturer specific data in data format C5, starting from the data format byte.
+// Data format C5 is data format 5 without the acceleration, and the mac address is optional
+func decodeFormatC5(data []byte) (Measurement, error) {
+	var m Measurement
+	if len(data) < 12 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
+	}
+
+	if data[0] != 0xc5 { // data format
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not in data format C5")
+	}
+
+	m.DataFormat = int64(data[0])
+	if !bytes.Equal(data[1:3], []byte{0x80, 0x00}) {
+		m.Temperature = f64(float64(int16(binary.BigEndian.Uint16(data[1:3]))) / 200)
+	}
+	if !bytes.Equal(data[3:5], []byte{0xff, 0xff}) {
+		m.Humidity = f64(float64(binary.BigEndian.Uint16(data[3:5])) / 400)
+	}
+	if !bytes.Equal(data[5:7], []byte{0xff, 0xff}) {
+		m.Pressure = f64(float64(binary.BigEndian.Uint16(data[5:7])) + 50_000)
+	}
+	if !bytes.Equal(data[7:9], []byte{0xff, 0xff}) {
+		powerInfo := binary.BigEndian.Uint16(data[7:9])
+		m.BatteryVoltage = f64(float64(powerInfo>>5)/1000 + 1.6)
+		m.TxPower = i64(int64(powerInfo&0b11111)*2 - 40)
+	}
+	if data[9] != 0xff {
+		m.MovementCounter = i64(int64(data[9]))
+	}
+	if !bytes.Equal(data[10:12], []byte{0xff, 0xff}) {
+		m.MeasurementSequenceNumber = i64(int64(binary.BigEndian.Uint16(data[10:12])))
+	}
+	if len(data) >= 18 {
+		m.EmbeddedMac = formatMac(data[12:18])
+	}
+
+	return m, nil
+}
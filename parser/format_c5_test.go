@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+func buildFullAdvertisementFormatC5(payload []byte) []byte {
+	adv := []byte{0x02, 0x01, 0x06, byte(len(payload) + 3), 0xFF, 0x99, 0x04}
+	return append(adv, payload...)
+}
+
+func TestParseFormatC5_OK(t *testing.T) {
+	payload := []byte{
+		0xC5, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0xAC,
+		0x36, 0x42, 0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C,
+		0x88, 0x4F,
+	}
+	m, err := ParseFormatC5(hex.EncodeToString(buildFullAdvertisementFormatC5(payload)))
+	if err != nil {
+		t.Fatalf("ParseFormatC5 returned error: %v", err)
+	}
+
+	if m.DataFormat != 0xC5 {
+		t.Errorf("DataFormat: got %d want %d", m.DataFormat, 0xC5)
+	}
+	if m.FormatName() != "C5" {
+		t.Errorf("FormatName: got %s want %s", m.FormatName(), "C5")
+	}
+	if m.Temperature == nil || int(math.Round(*m.Temperature*1000)) != 24300 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 24.3)
+	}
+	if m.Humidity == nil || int(math.Round(*m.Humidity*10000)) != 534900 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 53.49)
+	}
+	if m.Pressure == nil || int(math.Round(*m.Pressure)) != 100044 {
+		t.Errorf("Pressure: got %v want %v", m.Pressure, 100044)
+	}
+	if m.AccelerationX != nil || m.AccelerationY != nil || m.AccelerationZ != nil {
+		t.Errorf("Acceleration: expected nil")
+	}
+	if m.BatteryVoltage == nil || int(math.Round(*m.BatteryVoltage*1000)) != 2977 {
+		t.Errorf("BatteryVoltage: got %v want %v", m.BatteryVoltage, 2.977)
+	}
+	if m.TxPower == nil || *m.TxPower != 4 {
+		t.Errorf("TxPower: got %v want %v", m.TxPower, 4)
+	}
+	if m.MovementCounter == nil || *m.MovementCounter != 66 {
+		t.Errorf("MovementCounter: got %v want %v", m.MovementCounter, 66)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 205 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 205)
+	}
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "CB:B8:33:4C:88:4F" {
+		t.Errorf("EmbeddedMac: got %v want %v", m.EmbeddedMac, "CB:B8:33:4C:88:4F")
+	}
+}
+
+func TestParseFormatC5_MaximumValues(t *testing.T) {
+	payload := []byte{
+		0xC5, 0x7F, 0xFF, 0xFF, 0xFE, 0xFF, 0xFE, 0xFF,
+		0xDE, 0xFE, 0xFF, 0xFE, 0xCB, 0xB8, 0x33, 0x4C,
+		0x88, 0x4F,
+	}
+	m, err := ParseFormatC5(hex.EncodeToString(buildFullAdvertisementFormatC5(payload)))
+	if err != nil {
+		t.Fatalf("ParseFormatC5 returned error: %v", err)
+	}
+
+	if m.Temperature == nil || int(math.Round(*m.Temperature*1000)) != 163835 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 163.835)
+	}
+	if m.Humidity == nil || int(math.Round(*m.Humidity*10000)) != 1638350 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 163.835)
+	}
+	if m.Pressure == nil || int(math.Round(*m.Pressure)) != 115534 {
+		t.Errorf("Pressure: got %v want %v", m.Pressure, 115534)
+	}
+	if m.BatteryVoltage == nil || int(math.Round(*m.BatteryVoltage*1000)) != 3646 {
+		t.Errorf("BatteryVoltage: got %v want %v", m.BatteryVoltage, 3.646)
+	}
+	if m.TxPower == nil || *m.TxPower != 20 {
+		t.Errorf("TxPower: got %v want %v", m.TxPower, 20)
+	}
+	if m.MovementCounter == nil || *m.MovementCounter != 254 {
+		t.Errorf("MovementCounter: got %v want %v", m.MovementCounter, 254)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 65534 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 65534)
+	}
+}
+
+func TestParseFormatC5_MinimumValues(t *testing.T) {
+	payload := []byte{
+		0xC5, 0x80, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0xCB, 0xB8, 0x33, 0x4C,
+		0x88, 0x4F,
+	}
+	m, err := ParseFormatC5(hex.EncodeToString(buildFullAdvertisementFormatC5(payload)))
+	if err != nil {
+		t.Fatalf("ParseFormatC5 returned error: %v", err)
+	}
+
+	if m.Temperature == nil || int(math.Round(*m.Temperature*1000)) != -163835 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, -163.835)
+	}
+	if m.Humidity == nil || *m.Humidity != 0 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 0)
+	}
+	if m.Pressure == nil || int(math.Round(*m.Pressure)) != 50000 {
+		t.Errorf("Pressure: got %v want %v", m.Pressure, 50000)
+	}
+	if m.BatteryVoltage == nil || int(math.Round(*m.BatteryVoltage*1000)) != 1600 {
+		t.Errorf("BatteryVoltage: got %v want %v", m.BatteryVoltage, 1.6)
+	}
+	if m.TxPower == nil || *m.TxPower != -40 {
+		t.Errorf("TxPower: got %v want %v", m.TxPower, -40)
+	}
+	if m.MovementCounter == nil || *m.MovementCounter != 0 {
+		t.Errorf("MovementCounter: got %v want %v", m.MovementCounter, 0)
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 0 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 0)
+	}
+}
+
+func TestParseFormatC5_InvalidValues(t *testing.T) {
+	payload := []byte{
+		0xC5, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF,
+	}
+	m, err := ParseFormatC5(hex.EncodeToString(buildFullAdvertisementFormatC5(payload)))
+	if err != nil {
+		t.Fatalf("ParseFormatC5 returned error: %v", err)
+	}
+
+	if m.Temperature != nil {
+		t.Errorf("Temperature: expected nil, got %v", *m.Temperature)
+	}
+	if m.Humidity != nil {
+		t.Errorf("Humidity: expected nil, got %v", *m.Humidity)
+	}
+	if m.Pressure != nil {
+		t.Errorf("Pressure: expected nil, got %v", *m.Pressure)
+	}
+	if m.BatteryVoltage != nil {
+		t.Errorf("BatteryVoltage: expected nil, got %v", *m.BatteryVoltage)
+	}
+	if m.TxPower != nil {
+		t.Errorf("TxPower: expected nil, got %v", *m.TxPower)
+	}
+	if m.MovementCounter != nil {
+		t.Errorf("MovementCounter: expected nil, got %v", *m.MovementCounter)
+	}
+	if m.MeasurementSequenceNumber != nil {
+		t.Errorf("MeasurementSequenceNumber: expected nil, got %v", *m.MeasurementSequenceNumber)
+	}
+	if m.EmbeddedMac != nil {
+		t.Errorf("EmbeddedMac: expected nil, got %v", *m.EmbeddedMac)
+	}
+}
+
+func TestParseFormatC5_WithoutMac(t *testing.T) {
+	payload := []byte{
+		0xC5, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0xAC,
+		0x36, 0x42, 0x00, 0xCD,
+	}
+	m, ok := Parse(hex.EncodeToString(buildFullAdvertisementFormatC5(payload)))
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+	if m.FormatName() != "C5" {
+		t.Errorf("FormatName: got %s want %s", m.FormatName(), "C5")
+	}
+	if m.MeasurementSequenceNumber == nil || *m.MeasurementSequenceNumber != 205 {
+		t.Errorf("MeasurementSequenceNumber: got %v want %v", m.MeasurementSequenceNumber, 205)
+	}
+	if m.EmbeddedMac != nil {
+		t.Errorf("EmbeddedMac: expected nil, got %v", *m.EmbeddedMac)
+	}
+}
+
+func TestParseFormatC5_Invalid(t *testing.T) {
+	if _, err := ParseFormatC5(hex.EncodeToString(buildFullAdvertisementFormatC5([]byte{0xC5, 0x12, 0xFC, 0x53}))); err == nil {
+		t.Errorf("ParseFormatC5: expected error for truncated data")
+	}
+	format5 := buildFullAdvertisementFormat5([]byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	})
+	if _, err := ParseFormatC5(hex.EncodeToString(format5)); err == nil {
+		t.Errorf("ParseFormatC5: expected error for format 5 data")
+	}
+}
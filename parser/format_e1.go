@@ -3,34 +3,25 @@ package parser
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/hex"
-	"errors"
-
-	"github.com/rs/zerolog/log"
 )
 
-func ParseFormatE1(input string) (Measurement, error) {
-	var m Measurement
-	data, err := hex.DecodeString(input)
-	if err != nil {
-		return m, err
-	}
-	if len(data) < 32 {
-		return m, errors.New("data is too short")
-	}
+func init() {
+	RegisterDecoder(ruuviCompanyIdentifier, 0xe1, "E1", decodeFormatE1)
+}
 
-	if data[1] != 0xff { // manufacturer specific data
-		return m, errors.New("data is not manufacturer specific data")
-	}
+func ParseFormatE1(input string) (Measurement, error) {
+	return parseRuuviFormat(input, 1, "E1", decodeFormatE1)
+}
 
-	if data[2] != ruuviCompanyIdentifier[0] || data[3] != ruuviCompanyIdentifier[1] {
-		return m, errors.New("data has wrong company identifier")
+// decodeFormatE1 decodes Ruuvi manufacturer specific data in data format E1, starting from the data format byte
+func decodeFormatE1(data []byte) (Measurement, error) {
+	var m Measurement
+	if len(data) < 29 {
+		return m, newParseError(ReasonTooShort, len(data), "", "data is too short")
 	}
 
-	data = data[4:]
-
 	if data[0] != 0xe1 { // data format
-		return m, errors.New("data is not in data format E1")
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not in data format E1")
 	}
 
 	m.DataFormat = int64(data[0])
@@ -121,9 +112,10 @@ func ParseFormatE1(input string) (Measurement, error) {
 		m.NOX = f64(float64(combinedNOX))
 	}
 
-	log.Trace().
-		Str("raw_data", input).
-		Int64("data_format", m.DataFormat).
-		Msg("Successfully parsed data")
+	// MAC address (offset 34-39), after 5 reserved bytes
+	if len(data) >= 40 {
+		m.EmbeddedMac = formatMac(data[34:40])
+	}
+
 	return m, nil
 }
@@ -122,6 +122,9 @@ func TestParseFormatE1_OK(t *testing.T) {
 	if m.RtcOnBoot == nil || *m.RtcOnBoot != false {
 		t.Errorf("RtcOnBoot: got %v want %v", m.RtcOnBoot, false)
 	}
+	if m.EmbeddedMac == nil || *m.EmbeddedMac != "CB:B8:33:4C:88:4F" {
+		t.Errorf("EmbeddedMac: got %v want %v", m.EmbeddedMac, "CB:B8:33:4C:88:4F")
+	}
 }
 
 func TestParseFormatE1_Zeroes(t *testing.T) {
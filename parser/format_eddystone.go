@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const eddystoneServiceUUID = 0xfeaa
+
+func init() {
+	RegisterServiceDataDecoder(eddystoneServiceUUID, decodeEddystone, "2", "4")
+}
+
+func ParseFormat2(input string) (Measurement, error) {
+	return parseEddystoneFormat(input, 0x02)
+}
+
+func ParseFormat4(input string) (Measurement, error) {
+	return parseEddystoneFormat(input, 0x04)
+}
+
+func parseEddystoneFormat(input string, format int64) (Measurement, error) {
+	data, err := decodeHex(input)
+	if err != nil {
+		return Measurement{}, err
+	}
+	formatName := fmt.Sprintf("%X", format)
+	adv, err := ParseAdvertisement(data)
+	if err != nil {
+		return Measurement{}, &ParseError{Format: formatName, Reason: ReasonMalformedAdvertisement, Raw: data, Err: err}
+	}
+	frame := adv.FindServiceData(eddystoneServiceUUID)
+	if frame == nil {
+		return Measurement{}, &ParseError{Format: formatName, Reason: ReasonWrongFormat, Raw: data, Err: errors.New("data does not contain Eddystone service data")}
+	}
+	m, err := decodeEddystone(frame)
+	if err != nil {
+		return Measurement{}, asParseError(err, formatName, data, frame)
+	}
+	if m.DataFormat != format {
+		return Measurement{}, &ParseError{Format: formatName, Reason: ReasonWrongFormat, Offset: offsetOf(data, frame) + eddystoneURLOffset, Raw: data, Err: fmt.Errorf("data is not in data format %X", format)}
+	}
+	applyAdvertisement(&m, adv)
+
+	log.Trace().
+		Str("raw_data", input).
+		Int64("data_format", m.DataFormat).
+		Msg("Successfully parsed data")
+	return m, nil
+}
+
+// eddystoneURLOffset is the offset of the encoded data in the Eddystone-URL frame, after the frame type, tx power,
+// url scheme and "ruu.vi/#"
+const eddystoneURLOffset = 3 + len("ruu.vi/#")
+
+func eddystoneURLError(reason ParseErrorReason, err error, format string) *ParseError {
+	return &ParseError{Format: format, Reason: reason, Field: "url", Offset: eddystoneURLOffset, Err: err}
+}
+
+// decodeEddystone decodes the ruu.vi URL in an Eddystone-URL frame in data format 2 or 4
+func decodeEddystone(frame []byte) (Measurement, error) {
+	var m Measurement
+	if len(frame) < 3 {
+		return m, newParseError(ReasonTooShort, len(frame), "", "data is too short")
+	}
+	if frame[0] != 0x10 { // frame type
+		return m, newParseError(ReasonWrongFormat, 0, "", "data is not an Eddystone-URL frame")
+	}
+	url := string(frame[3:]) // skip frame type, tx power and url scheme
+	if !strings.HasPrefix(url, "ruu.vi/#") {
+		return m, newParseError(ReasonWrongFormat, 3, "url", "data is not a ruu.vi URL")
+	}
+	encoded := strings.TrimPrefix(url, "ruu.vi/#")
+
+	var data []byte
+	var err error
+	switch len(encoded) {
+	case 8:
+		data, err = base64.URLEncoding.DecodeString(encoded)
+		if err != nil {
+			return m, eddystoneURLError(ReasonInvalidValue, err, "2")
+		}
+		if data[0] != 0x02 { // data format
+			return m, eddystoneURLError(ReasonWrongFormat, errors.New("data is not in data format 2"), "2")
+		}
+	case 9:
+		// The 9th character is a truncated 7th byte, pad it so that it can be decoded
+		data, err = base64.RawURLEncoding.DecodeString(encoded + "A")
+		if err != nil {
+			return m, eddystoneURLError(ReasonInvalidValue, err, "4")
+		}
+		if data[0] != 0x04 { // data format
+			return m, eddystoneURLError(ReasonWrongFormat, errors.New("data is not in data format 4"), "4")
+		}
+		// Random tag ID, only the 4 most significant bits fit in the URL
+		m.RandomId = i64(int64(data[6] >> 4))
+	default:
+		return m, newParseError(ReasonWrongFormat, eddystoneURLOffset, "url", "data is not in data format 2 or 4")
+	}
+
+	m.DataFormat = int64(data[0])
+	m.Humidity = f64(float64(data[1]) / 2)
+	temperatureSign := (data[2] >> 7) & 1
+	temperatureBase := data[2] & 0x7F
+	temperatureFraction := float64(data[3]) / 100
+	temperature := float64(temperatureBase) + temperatureFraction
+	if temperatureSign == 1 {
+		temperature *= -1
+	}
+	m.Temperature = f64(temperature)
+	m.Pressure = f64(float64(binary.BigEndian.Uint16(data[4:6])) + 50_000)
+	return m, nil
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+func buildFullAdvertisementEddystone(url string) []byte {
+	frame := []byte{0x16, 0xAA, 0xFE, 0x10, 0xF9, 0x03} // service data, Eddystone UUID, URL frame, tx power, https://
+	frame = append(frame, []byte(url)...)
+	adv := []byte{0x02, 0x01, 0x06, 0x03, 0x03, 0xAA, 0xFE, byte(len(frame))}
+	adv = append(adv, frame...)
+	return adv
+}
+
+func TestParseFormat2_OK(t *testing.T) {
+	adv := buildFullAdvertisementEddystone("ruu.vi/#AjwYAMFc")
+	hexStr := hex.EncodeToString(adv)
+
+	m, err := ParseFormat2(hexStr)
+	if err != nil {
+		t.Fatalf("ParseFormat2 returned error: %v", err)
+	}
+
+	if m.DataFormat != 0x02 {
+		t.Errorf("DataFormat: got %d want %d", m.DataFormat, 0x02)
+	}
+	if m.Humidity == nil || *m.Humidity != 30 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 30)
+	}
+	if m.Temperature == nil || *m.Temperature != 24 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 24)
+	}
+	if m.Pressure == nil || *m.Pressure != 99500 {
+		t.Errorf("Pressure: got %v want %v", m.Pressure, 99500)
+	}
+	if m.RandomId != nil {
+		t.Errorf("RandomId: expected nil, got %v", *m.RandomId)
+	}
+}
+
+func TestParseFormat2_NegativeTemperature(t *testing.T) {
+	// 02 64 8A 32 C1 5C: 50% humidity, -10.50 C, 99500 Pa
+	adv := buildFullAdvertisementEddystone("ruu.vi/#AmSKMsFc")
+	hexStr := hex.EncodeToString(adv)
+
+	m, err := ParseFormat2(hexStr)
+	if err != nil {
+		t.Fatalf("ParseFormat2 returned error: %v", err)
+	}
+
+	if m.Humidity == nil || *m.Humidity != 50 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 50)
+	}
+	if m.Temperature == nil || int(math.Round(*m.Temperature*100)) != -1050 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, -10.5)
+	}
+}
+
+func TestParseFormat4_OK(t *testing.T) {
+	adv := buildFullAdvertisementEddystone("ruu.vi/#BDwYAMFcw")
+	hexStr := hex.EncodeToString(adv)
+
+	m, err := ParseFormat4(hexStr)
+	if err != nil {
+		t.Fatalf("ParseFormat4 returned error: %v", err)
+	}
+
+	if m.DataFormat != 0x04 {
+		t.Errorf("DataFormat: got %d want %d", m.DataFormat, 0x04)
+	}
+	if m.Humidity == nil || *m.Humidity != 30 {
+		t.Errorf("Humidity: got %v want %v", m.Humidity, 30)
+	}
+	if m.Temperature == nil || *m.Temperature != 24 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 24)
+	}
+	if m.Pressure == nil || *m.Pressure != 99500 {
+		t.Errorf("Pressure: got %v want %v", m.Pressure, 99500)
+	}
+	if m.RandomId == nil || *m.RandomId != 12 {
+		t.Errorf("RandomId: got %v want %v", m.RandomId, 12)
+	}
+}
+
+func TestParseFormat2And4_WrongFormat(t *testing.T) {
+	format2 := hex.EncodeToString(buildFullAdvertisementEddystone("ruu.vi/#AjwYAMFc"))
+	format4 := hex.EncodeToString(buildFullAdvertisementEddystone("ruu.vi/#BDwYAMFcw"))
+	otherURL := hex.EncodeToString(buildFullAdvertisementEddystone("example.com/#AjwYAMFc"))
+
+	if _, err := ParseFormat4(format2); err == nil {
+		t.Errorf("ParseFormat4: expected error for format 2 data")
+	}
+	if _, err := ParseFormat2(format4); err == nil {
+		t.Errorf("ParseFormat2: expected error for format 4 data")
+	}
+	if _, err := ParseFormat2(otherURL); err == nil {
+		t.Errorf("ParseFormat2: expected error for a non ruu.vi URL")
+	}
+}
@@ -1,12 +1,39 @@
 package parser
 
+import "fmt"
+
 type Measurement struct {
 	CommonData
 	BasicEnvironmentalData
 	AirQualityData
 	DiagnosticsData
 	UnofficialData
+	SensorData
 	CalculatedData
+	AdvertisementData
+}
+
+// FormatName returns the name of the data format, which is used for example in the disable_formats config
+func (m Measurement) FormatName() string {
+	if m.DataFormatName != "" {
+		return m.DataFormatName
+	}
+	return fmt.Sprintf("%X", m.DataFormat)
+}
+
+// TagMetadata returns the configured metadata of the tag, including the location, room, floor and owner, as key/value
+// pairs. The location, room, floor and owner take precedence over the arbitrary metadata with the same key
+func (m Measurement) TagMetadata() map[string]string {
+	metadata := make(map[string]string, len(m.Metadata)+4)
+	for key, value := range m.Metadata {
+		metadata[key] = value
+	}
+	for key, value := range map[string]*string{"location": m.Location, "room": m.Room, "floor": m.Floor, "owner": m.Owner} {
+		if value != nil {
+			metadata[key] = *value
+		}
+	}
+	return metadata
 }
 
 // Common data for all measurements
@@ -15,6 +42,28 @@ type CommonData struct {
 	Mac        string  `json:"mac,omitempty"`
 	Timestamp  *int64  `json:"timestamp,omitempty"`
 	DataFormat int64   `json:"data_format,omitempty"`
+	// Name of the format, which identifies the formats without a plain data format byte, see FormatName
+	DataFormatName string `json:"data_format_name,omitempty"`
+	// Mac address of the gateway that received the data, if known
+	GatewayMac *string `json:"gatewayMac,omitempty"`
+	// Type of the data source that received the data, such as gateway_polling, mqtt_listener or http_listener
+	SourceType string `json:"sourceType,omitempty"`
+	// Name of the data source that received the data, as configured or defaulted by the source
+	SourceName string `json:"sourceName,omitempty"`
+	// Time the bridge received the data, as unix milliseconds
+	ReceiveTime *int64 `json:"receiveTime,omitempty"`
+	// Raw data the measurement was parsed from, as received from the source
+	RawData string `json:"-"`
+	// FNV-1a hash of the manufacturer or service data the measurement was decoded from, zero if not decoded from an
+	// advertisement. Unlike the raw data, it does not depend on the other AD structures of the advertisement, which may
+	// differ between the sources
+	PayloadHash uint64 `json:"-"`
+	// Metadata of the tag, as configured in the tags config
+	Location *string           `json:"location,omitempty"`
+	Room     *string           `json:"room,omitempty"`
+	Floor    *string           `json:"floor,omitempty"`
+	Owner    *string           `json:"owner,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // Basic environmental data, typically on ruuvitags
@@ -43,10 +92,23 @@ type AirQualityData struct {
 	Illuminance *float64 `json:"illuminance,omitempty"`
 }
 
+// Data typically on third party sensors
+type SensorData struct {
+	BatteryLevel *float64 `json:"batteryLevel,omitempty"` // Battery level in %
+	Moisture     *float64 `json:"moisture,omitempty"`     // Moisture in %
+	Motion       *bool    `json:"motion,omitempty"`       // Whether motion is detected
+	Opening      *bool    `json:"opening,omitempty"`      // Whether a door or a window is open
+}
+
 // Diagnostics data
 type DiagnosticsData struct {
-	MeasurementSequenceNumber *int64 `json:"measurementSequenceNumber,omitempty"`
-	CalibrationInProgress     *bool  `json:"calibrationInProgress,omitempty"`
+	MeasurementSequenceNumber *int64  `json:"measurementSequenceNumber,omitempty"`
+	CalibrationInProgress     *bool   `json:"calibrationInProgress,omitempty"`
+	RandomId                  *int64  `json:"randomId,omitempty"`      // Random tag ID broadcast in format 4
+	EmbeddedMac               *string `json:"embeddedMac,omitempty"`   // MAC address broadcast within the data, only the last 3 bytes on format 6
+	MacMismatch               *bool   `json:"macMismatch,omitempty"`   // Whether the embedded MAC address disagrees with the reported MAC address
+	ParseFailures             *int64  `json:"parseFailures,omitempty"` // Number of packets from the tag that failed to parse since it was first parsed successfully
+	GatewayCount              *int64  `json:"gatewayCount,omitempty"`  // Number of gateways that received the packet, when deduplication is enabled
 }
 
 // Data not officially documented (eg. on format E1, transmitted by certain revisions of Ruuvi Air)
@@ -58,6 +120,13 @@ type UnofficialData struct {
 	RtcOnBoot           *bool    `json:"rtcOnBoot,omitempty"`
 }
 
+// Data from the other AD structures of the advertisement, outside of the actual measurement data
+type AdvertisementData struct {
+	LocalName          *string `json:"localName,omitempty"`
+	AdvertisementFlags *int64  `json:"advertisementFlags,omitempty"`
+	TxPowerLevel       *int64  `json:"txPowerLevel,omitempty"`
+}
+
 // Calculated data not actually present on measurements, but instead calculated
 type CalculatedData struct {
 	AccelerationTotal        *float64 `json:"accelerationTotal,omitempty"`
@@ -69,4 +138,5 @@ type CalculatedData struct {
 	AccelerationAngleFromY   *float64 `json:"accelerationAngleFromY,omitempty"`
 	AccelerationAngleFromZ   *float64 `json:"accelerationAngleFromZ,omitempty"`
 	AirQualityIndex          *float64 `json:"airQualityIndex,omitempty"`
+	ContinuousSequenceNumber *int64   `json:"continuousSequenceNumber,omitempty"`
 }
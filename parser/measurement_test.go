@@ -0,0 +1,22 @@
+package parser
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestTagMetadata(t *testing.T) {
+	room := "Kitchen"
+	m := Measurement{}
+	m.Room = &room
+	m.Metadata = map[string]string{"room": "Overridden", "building": "B"}
+
+	got := m.TagMetadata()
+	expected := map[string]string{"room": "Kitchen", "building": "B"}
+	if !maps.Equal(got, expected) {
+		t.Errorf("TagMetadata: got %v want %v", got, expected)
+	}
+	if m.Metadata["room"] != "Overridden" {
+		t.Errorf("expected the metadata of the measurement to be left intact")
+	}
+}
@@ -1,8 +1,13 @@
 package parser
 
-import "github.com/rs/zerolog/log"
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
 
-var ruuviCompanyIdentifier = []byte{0x99, 0x04} // 0x0499
+	"github.com/rs/zerolog/log"
+)
 
 func f64(value float64) *float64 {
 	return &value
@@ -11,27 +16,183 @@ func i64(value int64) *int64 {
 	return &value
 }
 
+const hexDigits = "0123456789ABCDEF"
+
+// formatMac formats the mac address embedded in the data, returning nil if the mac is not available
+func formatMac(data []byte) *string {
+	available := false
+	for _, b := range data {
+		if b != 0xff {
+			available = true
+			break
+		}
+	}
+	if !available {
+		return nil
+	}
+	buf := make([]byte, 0, len(data)*3)
+	for i, b := range data {
+		if i > 0 {
+			buf = append(buf, ':')
+		}
+		buf = append(buf, hexDigits[b>>4], hexDigits[b&0x0f])
+	}
+	mac := string(buf)
+	return &mac
+}
+
+// decodeHex decodes the hex encoded input
+func decodeHex(input string) ([]byte, error) {
+	data, err := hex.DecodeString(input)
+	if err != nil {
+		offset := strings.IndexFunc(input, func(r rune) bool {
+			return !strings.ContainsRune("0123456789abcdefABCDEF", r)
+		})
+		if offset == -1 {
+			offset = len(input)
+		}
+		return nil, &ParseError{Reason: ReasonInvalidHex, Offset: offset, Raw: []byte(input), Err: err}
+	}
+	return data, nil
+}
+
+// Parse decodes the hex encoded advertisement data with the matching registered decoder
 func Parse(input string) (Measurement, bool) {
-	var measurement Measurement
-	var err_formate1, err_format6, err_format5, err_format3 error
-	if measurement, err_formate1 = ParseFormatE1(input); err_formate1 == nil {
-		return measurement, true
+	m, err := Decode(input)
+	if err != nil {
+		log.Trace().
+			Str("raw_data", input).
+			Err(err).
+			Msg("Failed to parse data")
+		return Measurement{}, false
 	}
-	if measurement, err_format6 = ParseFormat6(input); err_format6 == nil {
-		return measurement, true
+	log.Trace().
+		Str("raw_data", input).
+		Str("data_format", m.FormatName()).
+		Msg("Successfully parsed data")
+	return m, true
+}
+
+// ParseBytes decodes the binary advertisement data with the matching registered decoder
+func ParseBytes(data []byte) (Measurement, bool) {
+	m, err := DecodeBytes(data)
+	if err != nil {
+		log.Trace().
+			Hex("raw_data", data).
+			Err(err).
+			Msg("Failed to parse data")
+		return Measurement{}, false
 	}
-	if measurement, err_format5 = ParseFormat5(input); err_format5 == nil {
-		return measurement, true
+	log.Trace().
+		Hex("raw_data", data).
+		Str("data_format", m.FormatName()).
+		Msg("Successfully parsed data")
+	return m, true
+}
+
+// Decode decodes the hex encoded advertisement data with the matching registered decoder.
+// If the decoding fails, the returned error is a *ParseError
+func Decode(input string) (Measurement, error) {
+	data, err := decodeHex(input)
+	if err != nil {
+		return Measurement{}, err
 	}
-	if measurement, err_format3 = ParseFormat3(input); err_format3 == nil {
-		return measurement, true
+	return DecodeBytes(data)
+}
+
+// DecodeBytes decodes the binary advertisement data with the matching registered decoder. The data is walked
+// through only once without copying, and only the decoder matching the data format is called. The data is not
+// retained, the only allocations are the values of the decoded measurement, as each of them is a pointer. When several
+// structures match a decoder, the first successfully decoded one is used, falling back to the first error.
+// If the decoding fails, the returned error is a *ParseError
+func DecodeBytes(data []byte) (Measurement, error) {
+	var adv Advertisement
+	var claimed, decoded bool
+	var m Measurement
+	var firstErr error
+	try := func(decode func() (Measurement, bool, error)) {
+		if decoded {
+			return
+		}
+		result, ok, err := decode()
+		if !ok {
+			return
+		}
+		claimed = true
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		m, decoded = result, true
+	}
+	it := adIterator{data: data}
+	for adType, value, ok := it.next(); ok; adType, value, ok = it.next() {
+		switch adType {
+		case adTypeManufacturerData:
+			if len(value) >= 2 {
+				try(func() (Measurement, bool, error) {
+					return decodeManufacturerData(data, binary.LittleEndian.Uint16(value[0:2]), value[2:])
+				})
+			}
+		case adTypeServiceData16:
+			if len(value) >= 2 {
+				try(func() (Measurement, bool, error) {
+					return decodeServiceData(data, binary.LittleEndian.Uint16(value[0:2]), value[2:])
+				})
+			}
+		default:
+			adv.addStructure(adType, value)
+		}
+	}
+	if it.err == nil && decoded {
+		applyAdvertisement(&m, adv)
+		return m, nil
+	}
+	if it.err == nil && claimed {
+		return Measurement{}, firstErr
+	}
+	// Fall back to the fixed offsets of Ruuvi manufacturer data used by older gateways and tools
+	for _, offset := range [...]int{4, 1} {
+		if payload, err := legacyRuuviManufacturerData(data, offset); err == nil {
+			if m, ok, err := decodeManufacturerData(data, ruuviCompanyIdentifier, payload); ok {
+				return m, err
+			}
+		}
+	}
+	if decoded {
+		applyAdvertisement(&m, adv)
+		return m, nil
+	}
+	if claimed {
+		return Measurement{}, firstErr
 	}
+	if it.err != nil {
+		return Measurement{}, &ParseError{Reason: ReasonMalformedAdvertisement, Offset: offsetOf(data, it.data), Raw: data, Err: it.err}
+	}
+	return Measurement{}, &ParseError{Reason: ReasonUnknownFormat, Raw: data, Err: errors.New("no decoder found for data")}
+}
+
+// parseRuuviFormat parses the advertisement with the given Ruuvi format decoder
+func parseRuuviFormat(input string, legacyOffset int, format string, decoder Decoder) (Measurement, error) {
+	data, err := decodeHex(input)
+	if err != nil {
+		return Measurement{}, err
+	}
+	adv, payload, err := ruuviManufacturerData(data, legacyOffset)
+	if err != nil {
+		return Measurement{}, asParseError(err, format, data, data)
+	}
+	m, err := decoder(payload)
+	if err != nil {
+		return Measurement{}, asParseError(err, format, data, payload)
+	}
+	applyAdvertisement(&m, adv)
+
 	log.Trace().
 		Str("raw_data", input).
-		Str("format_e1_error", err_formate1.Error()).
-		Str("format_6_error", err_format6.Error()).
-		Str("format_5_error", err_format5.Error()).
-		Str("format_3_error", err_format3.Error()).
-		Msg("Failed to parse data")
-	return Measurement{}, false
+		Int64("data_format", m.DataFormat).
+		Msg("Successfully parsed data")
+	return m, nil
 }
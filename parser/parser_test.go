@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+var benchmarkFormat5 = hex.EncodeToString(buildFullAdvertisementFormat5([]byte{
+	0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+	0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+	0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+}))
+
+func BenchmarkParse(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, ok := Parse(benchmarkFormat5); !ok {
+			b.Fatal("parse failed")
+		}
+	}
+}
+
+func BenchmarkParseBytes(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	data, _ := hex.DecodeString(benchmarkFormat5)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := ParseBytes(data); !ok {
+			b.Fatal("parse failed")
+		}
+	}
+}
+
+// benchmarkAdvertisements are valid advertisements of each format, as relayed by a Ruuvi Gateway
+var benchmarkAdvertisements = []struct {
+	format string
+	data   string
+}{
+	{"3", "02010611FF990403291A1ECE1EFC18F94202CA0B53"},
+	{"5", "0201061BFF99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"},
+	{"6", "02010617FF990406170C5668C79E007000C90501D9FFCD404C884F"},
+	{"E1", "0201062BFF9904E1170C5668C79E0065007004BD11CA00C9050113E0AC3D4AFE00CD010DFFFFFFFFFFCBB8334C884F"},
+	{"C5", "02010615FF9904C512FC5394C37CAC364200CDCBB8334C884F"},
+	{"ATC1441", "02010610161A18A4C13801020300EB2D550B7C11"},
+	{"BTHome", "0201060D16D2FC400164EE01020302CA09"},
+	{"Eddystone", "0201060303AAFE1616AAFE10F9037275752E76692F23416A7759414D4663"},
+}
+
+func BenchmarkDecode(b *testing.B) {
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	for _, adv := range benchmarkAdvertisements {
+		b.Run(adv.format, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Decode(adv.data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	data, _ := hex.DecodeString(benchmarkFormat5)
+	m, ok := ParseBytes(data)
+	if !ok {
+		t.Fatalf("ParseBytes failed")
+	}
+	expected, err := ParseFormat5(benchmarkFormat5)
+	if err != nil {
+		t.Fatalf("ParseFormat5 returned error: %v", err)
+	}
+	if m.DataFormat != 5 || *m.Temperature != *expected.Temperature || *m.EmbeddedMac != *expected.EmbeddedMac {
+		t.Errorf("ParseBytes: got %+v want %+v", m, expected)
+	}
+
+	if _, ok := ParseBytes([]byte{0x02, 0x01, 0x06, 0x03, 0xff, 0x99, 0x04}); ok {
+		t.Errorf("ParseBytes: expected failure for data without a known format")
+	}
+	if _, ok := ParseBytes([]byte{0x1f, 0xff}); ok {
+		t.Errorf("ParseBytes: expected failure for truncated data")
+	}
+}
+
+func TestDecodeBytes_MalformedStructureBeforeValid(t *testing.T) {
+	valid, _ := hex.DecodeString(benchmarkFormat5)
+	malformedATC := []byte{0x04, 0x16, 0x1a, 0x18, 0x00} // environmental sensing service data, too short
+	data := append(append(append([]byte{}, valid[:3]...), malformedATC...), valid[3:]...)
+	m, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatalf("DecodeBytes: expected the valid Ruuvi data after the malformed structure to be decoded, got %v", err)
+	}
+	if m.DataFormat != 5 {
+		t.Errorf("DecodeBytes: got format %s want 5", m.FormatName())
+	}
+
+	if _, err := DecodeBytes(append(append([]byte{}, valid[:3]...), malformedATC...)); err == nil {
+		t.Errorf("DecodeBytes: expected the error of the malformed structure without valid data")
+	}
+}
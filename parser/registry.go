@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"strings"
+	"sync"
+)
+
+// Decoder decodes the data of a single format. For manufacturer specific data the data starts from the data
+// format byte (after the company identifier), and for service data after the service UUID.
+type Decoder func(data []byte) (Measurement, error)
+
+type manufacturerDecoder struct {
+	name   string
+	decode Decoder
+}
+
+type serviceDataDecoder struct {
+	names  []string
+	decode Decoder
+}
+
+var registry = struct {
+	sync.RWMutex
+	manufacturer map[uint32]manufacturerDecoder
+	serviceData  map[uint16]serviceDataDecoder
+}{
+	manufacturer: make(map[uint32]manufacturerDecoder),
+	serviceData:  make(map[uint16]serviceDataDecoder),
+}
+
+func manufacturerKey(companyID uint16, format byte) uint32 {
+	return uint32(companyID)<<8 | uint32(format)
+}
+
+// RegisterDecoder registers a decoder for manufacturer specific data with the given company identifier and data format byte.
+// The name identifies the format, for example in the disable_formats config, and is set on the decoded measurements.
+// Registering a decoder for an already registered company identifier and format replaces the previous decoder.
+func RegisterDecoder(companyID uint16, format byte, name string, decoder Decoder) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.manufacturer[manufacturerKey(companyID, format)] = manufacturerDecoder{name: name, decode: decoder}
+}
+
+// RegisterServiceDataDecoder registers a decoder for service data with the given 16-bit service UUID. The decoder is
+// responsible for setting the data format on the measurements, and names lists the format names it may produce.
+// Registering a decoder for an already registered UUID replaces the previous decoder.
+func RegisterServiceDataDecoder(uuid uint16, decoder Decoder, names ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.serviceData[uuid] = serviceDataDecoder{names: names, decode: decoder}
+}
+
+// RegisteredFormats returns the names of all registered formats
+func RegisteredFormats() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var names []string
+	for _, d := range registry.manufacturer {
+		names = append(names, d.name)
+	}
+	for _, d := range registry.serviceData {
+		names = append(names, d.names...)
+	}
+	return names
+}
+
+// payloadHash returns the 64-bit FNV-1a hash of the data, computed inline as hash/fnv would allocate
+func payloadHash(data []byte) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, b := range data {
+		hash ^= uint64(b)
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// decodeManufacturerData decodes the manufacturer specific data with the matching registered decoder.
+// Raw is the whole advertisement the data is a part of
+func decodeManufacturerData(raw []byte, companyID uint16, data []byte) (Measurement, bool, error) {
+	if len(data) == 0 {
+		return Measurement{}, false, nil
+	}
+	registry.RLock()
+	d, ok := registry.manufacturer[manufacturerKey(companyID, data[0])]
+	registry.RUnlock()
+	if !ok {
+		return Measurement{}, false, nil
+	}
+	m, err := d.decode(data)
+	if err != nil {
+		return m, true, asParseError(err, d.name, raw, data)
+	}
+	m.DataFormatName = d.name
+	m.PayloadHash = payloadHash(data)
+	return m, true, nil
+}
+
+// decodeServiceData decodes the service data with the matching registered decoder.
+// Raw is the whole advertisement the data is a part of
+func decodeServiceData(raw []byte, uuid uint16, data []byte) (Measurement, bool, error) {
+	registry.RLock()
+	d, ok := registry.serviceData[uuid]
+	registry.RUnlock()
+	if !ok {
+		return Measurement{}, false, nil
+	}
+	m, err := d.decode(data)
+	if err != nil {
+		return m, true, asParseError(err, strings.Join(d.names, "/"), raw, data)
+	}
+	m.PayloadHash = payloadHash(data)
+	return m, true, nil
+}
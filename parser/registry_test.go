@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// registerTestDecoder registers the decoder for the duration of the test, restoring the registry afterwards
+func registerTestDecoder(t *testing.T, companyID uint16, format byte, name string, decoder Decoder) {
+	key := manufacturerKey(companyID, format)
+	registry.RLock()
+	previous, registered := registry.manufacturer[key]
+	registry.RUnlock()
+	t.Cleanup(func() {
+		registry.Lock()
+		defer registry.Unlock()
+		if registered {
+			registry.manufacturer[key] = previous
+		} else {
+			delete(registry.manufacturer, key)
+		}
+	})
+	RegisterDecoder(companyID, format, name, decoder)
+}
+
+func TestParse_RegisteredDecoder(t *testing.T) {
+	registerTestDecoder(t, 0xFFFF, 0x01, "test", func(data []byte) (Measurement, error) {
+		if len(data) < 2 {
+			return Measurement{}, errors.New("data is too short")
+		}
+		return Measurement{BasicEnvironmentalData: BasicEnvironmentalData{Temperature: f64(float64(data[1]))}}, nil
+	})
+	if !slices.Contains(RegisteredFormats(), "test") {
+		t.Errorf("RegisteredFormats: expected %v to contain %v", RegisteredFormats(), "test")
+	}
+
+	m, ok := Parse(hex.EncodeToString([]byte{0x02, 0x01, 0x06, 0x05, 0xFF, 0xFF, 0xFF, 0x01, 0x15}))
+	if !ok {
+		t.Fatalf("Parse failed for a registered decoder")
+	}
+	if m.FormatName() != "test" {
+		t.Errorf("FormatName: got %v want %v", m.FormatName(), "test")
+	}
+	if m.Temperature == nil || *m.Temperature != 21 {
+		t.Errorf("Temperature: got %v want %v", m.Temperature, 21)
+	}
+
+	if _, ok := Parse(hex.EncodeToString([]byte{0x02, 0x01, 0x06, 0x04, 0xFF, 0xFF, 0xFF, 0x01})); ok {
+		t.Errorf("Parse: expected failure when the registered decoder fails")
+	}
+	if _, ok := Parse(hex.EncodeToString([]byte{0x02, 0x01, 0x06, 0x05, 0xFF, 0xFF, 0xFF, 0x02, 0x15})); ok {
+		t.Errorf("Parse: expected failure for an unregistered format")
+	}
+}
+
+func TestParse_Dispatch(t *testing.T) {
+	format5 := buildFullAdvertisementFormat5([]byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	})
+	format3 := buildFullAdvertisementFormat3([]byte{
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC, 0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	})
+	format2 := buildFullAdvertisementEddystone("ruu.vi/#AjwYAMFc")
+
+	for _, tc := range []struct {
+		data   []byte
+		format string
+	}{
+		{format5, "5"},
+		{format3, "3"},
+		{format2, "2"},
+	} {
+		m, ok := Parse(hex.EncodeToString(tc.data))
+		if !ok {
+			t.Errorf("Parse failed for format %v", tc.format)
+			continue
+		}
+		if m.FormatName() != tc.format {
+			t.Errorf("FormatName: got %v want %v", m.FormatName(), tc.format)
+		}
+	}
+}
+
+func TestPayloadHash(t *testing.T) {
+	// the FNV-1a test vectors
+	if hash := payloadHash(nil); hash != 0xcbf29ce484222325 {
+		t.Errorf("empty data: got %016x", hash)
+	}
+	if hash := payloadHash([]byte("a")); hash != 0xaf63dc4c8601ec8c {
+		t.Errorf("\"a\": got %016x", hash)
+	}
+}
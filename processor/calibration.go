@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+// linearCalibration corrects a measured value as value * scale + offset. A two-point calibration is converted to the
+// line going through the two points
+type linearCalibration struct {
+	scale  float64
+	offset float64
+}
+
+func newLinearCalibration(conf *config.Calibration) (*linearCalibration, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if len(conf.Points) > 0 {
+		if conf.Offset != 0 || conf.Scale != nil {
+			return nil, errors.New("points cannot be combined with offset or scale")
+		}
+		if len(conf.Points) != 2 {
+			return nil, fmt.Errorf("expected 2 calibration points, got %d", len(conf.Points))
+		}
+		p1, p2 := conf.Points[0], conf.Points[1]
+		if p1.Raw == p2.Raw {
+			return nil, errors.New("the raw values of the calibration points must differ")
+		}
+		scale := (p2.Actual - p1.Actual) / (p2.Raw - p1.Raw)
+		return &linearCalibration{scale: scale, offset: p1.Actual - scale*p1.Raw}, nil
+	}
+	scale := 1.0
+	if conf.Scale != nil {
+		scale = *conf.Scale
+	}
+	return &linearCalibration{scale: scale, offset: conf.Offset}, nil
+}
+
+// apply returns the calibrated value. The value is copied, since the original may be shared with other copies of the
+// measurement
+func (c *linearCalibration) apply(v *float64) *float64 {
+	if c == nil || v == nil {
+		return v
+	}
+	calibrated := *v*c.scale + c.offset
+	return &calibrated
+}
+
+// tagCalibration is the calibration of the values of a single tag, nil for the values that are not calibrated
+type tagCalibration struct {
+	temperature   *linearCalibration
+	humidity      *linearCalibration
+	pressure      *linearCalibration
+	accelerationX *linearCalibration
+	accelerationY *linearCalibration
+	accelerationZ *linearCalibration
+	co2           *linearCalibration
+	pm1p0         *linearCalibration
+	pm2p5         *linearCalibration
+	pm4p0         *linearCalibration
+	pm10p0        *linearCalibration
+}
+
+func newTagCalibration(conf config.TagCalibration) (tagCalibration, error) {
+	var c tagCalibration
+	fields := []struct {
+		name   string
+		conf   *config.Calibration
+		target **linearCalibration
+	}{
+		{"temperature", conf.Temperature, &c.temperature},
+		{"humidity", conf.Humidity, &c.humidity},
+		{"pressure", conf.Pressure, &c.pressure},
+		{"acceleration_x", conf.AccelerationX, &c.accelerationX},
+		{"acceleration_y", conf.AccelerationY, &c.accelerationY},
+		{"acceleration_z", conf.AccelerationZ, &c.accelerationZ},
+		{"co2", conf.CO2, &c.co2},
+		{"pm1p0", conf.Pm1p0, &c.pm1p0},
+		{"pm2p5", conf.Pm2p5, &c.pm2p5},
+		{"pm4p0", conf.Pm4p0, &c.pm4p0},
+		{"pm10p0", conf.Pm10p0, &c.pm10p0},
+	}
+	for _, field := range fields {
+		calibration, err := newLinearCalibration(field.conf)
+		if err != nil {
+			return tagCalibration{}, fmt.Errorf("%s: %w", field.name, err)
+		}
+		*field.target = calibration
+	}
+	return c, nil
+}
+
+// calibrate corrects the measured values, before the extended values are calculated from them
+func (c tagCalibration) calibrate(m *parser.Measurement) {
+	m.Temperature = c.temperature.apply(m.Temperature)
+	m.Humidity = c.humidity.apply(m.Humidity)
+	if m.Humidity != nil && c.humidity != nil {
+		*m.Humidity = min(max(*m.Humidity, 0), 100)
+	}
+	m.Pressure = c.pressure.apply(m.Pressure)
+	m.AccelerationX = c.accelerationX.apply(m.AccelerationX)
+	m.AccelerationY = c.accelerationY.apply(m.AccelerationY)
+	m.AccelerationZ = c.accelerationZ.apply(m.AccelerationZ)
+	m.CO2 = c.co2.apply(m.CO2)
+	m.Pm1p0 = c.pm1p0.apply(m.Pm1p0)
+	m.Pm2p5 = c.pm2p5.apply(m.Pm2p5)
+	m.Pm4p0 = c.pm4p0.apply(m.Pm4p0)
+	m.Pm10p0 = c.pm10p0.apply(m.Pm10p0)
+}
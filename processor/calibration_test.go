@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func TestTagCalibration(t *testing.T) {
+	scale := 1.1
+	c, err := newTagCalibration(config.TagCalibration{
+		Temperature: &config.Calibration{Offset: -0.5},
+		Humidity:    &config.Calibration{Scale: &scale, Offset: 2},
+		CO2:         &config.Calibration{Points: []config.CalibrationPoint{{Raw: 400, Actual: 420}, {Raw: 1000, Actual: 990}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	temperature, humidity, pressure, co2 := 21.3, 95.0, 100000.0, 700.0
+	m := parser.Measurement{}
+	m.Temperature = &temperature
+	m.Humidity = &humidity
+	m.Pressure = &pressure
+	m.CO2 = &co2
+	c.calibrate(&m)
+
+	if math.Abs(*m.Temperature-20.8) > 1e-9 {
+		t.Errorf("Temperature: got %f want 20.8", *m.Temperature)
+	}
+	if *m.Humidity != 100 {
+		t.Errorf("Humidity: got %f, expected to be clamped to 100", *m.Humidity)
+	}
+	if m.Pressure != &pressure || *m.Pressure != 100000 {
+		t.Errorf("Pressure: expected to be left as is, got %f", *m.Pressure)
+	}
+	if math.Abs(*m.CO2-705) > 1e-9 {
+		t.Errorf("CO2: got %f want 705", *m.CO2)
+	}
+	if temperature != 21.3 || humidity != 95 || co2 != 700 {
+		t.Errorf("expected the original values to be left intact")
+	}
+}
+
+func TestTagCalibration_Invalid(t *testing.T) {
+	scale := 2.0
+	calibrations := map[string]config.Calibration{
+		"one point":             {Points: []config.CalibrationPoint{{Raw: 1, Actual: 2}}},
+		"same raw values":       {Points: []config.CalibrationPoint{{Raw: 1, Actual: 2}, {Raw: 1, Actual: 3}}},
+		"points with offset":    {Offset: 1, Points: []config.CalibrationPoint{{Raw: 1, Actual: 2}, {Raw: 2, Actual: 3}}},
+		"points with the scale": {Scale: &scale, Points: []config.CalibrationPoint{{Raw: 1, Actual: 2}, {Raw: 2, Actual: 3}}},
+	}
+	for name, calibration := range calibrations {
+		if _, err := newTagCalibration(config.TagCalibration{Pressure: &calibration}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/data_sinks"
+	"github.com/Scrin/RuuviBridge/data_sources"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+// dataSource describes a data source and the config section it is started with. When the config is reloaded, the
+// source is restarted only if its own section changed. Validate checks the section before anything is restarted
+type dataSource struct {
+	name     string
+	section  func(conf config.Config) any
+	enabled  func(conf config.Config) bool
+	validate func(conf config.Config) error
+	start    func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error)
+}
+
+var dataSources = []dataSource{
+	{
+		name:    "gateway_polling",
+		section: func(conf config.Config) any { return conf.GatewayPolling },
+		enabled: func(conf config.Config) bool {
+			return conf.GatewayPolling != nil && (conf.GatewayPolling.Enabled == nil || *conf.GatewayPolling.Enabled)
+		},
+		validate: func(conf config.Config) error { return data_sources.ValidateGatewayPolling(*conf.GatewayPolling) },
+		start: func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+			return data_sources.StartGatewayPolling(ctx, *conf.GatewayPolling, measurements)
+		},
+	},
+	{
+		name:    "mqtt_listener",
+		section: func(conf config.Config) any { return conf.MQTTListener },
+		enabled: func(conf config.Config) bool {
+			return conf.MQTTListener != nil && (conf.MQTTListener.Enabled == nil || *conf.MQTTListener.Enabled)
+		},
+		validate: func(conf config.Config) error { return data_sources.ValidateMQTTListener(*conf.MQTTListener) },
+		start: func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+			return data_sources.StartMQTTListener(ctx, *conf.MQTTListener, measurements)
+		},
+	},
+	{
+		name:    "http_listener",
+		section: func(conf config.Config) any { return conf.HTTPListener },
+		enabled: func(conf config.Config) bool {
+			return conf.HTTPListener != nil && (conf.HTTPListener.Enabled == nil || *conf.HTTPListener.Enabled)
+		},
+		validate: func(conf config.Config) error { return data_sources.ValidateHTTPListener(*conf.HTTPListener) },
+		start: func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+			return data_sources.StartHTTPListener(ctx, *conf.HTTPListener, measurements)
+		},
+	},
+	{
+		name:    "bluez_log",
+		section: func(conf config.Config) any { return conf.BluezLog },
+		enabled: func(conf config.Config) bool {
+			return conf.BluezLog != nil && (conf.BluezLog.Enabled == nil || *conf.BluezLog.Enabled)
+		},
+		validate: func(conf config.Config) error { return data_sources.ValidateBluezLog(*conf.BluezLog) },
+		start: func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+			return data_sources.StartBluezLog(ctx, *conf.BluezLog, measurements)
+		},
+	},
+	{
+		name:    "replay",
+		section: func(conf config.Config) any { return conf.Replay },
+		enabled: func(conf config.Config) bool {
+			return conf.Replay != nil && (conf.Replay.Enabled == nil || *conf.Replay.Enabled)
+		},
+		validate: func(conf config.Config) error { return data_sources.ValidateReplay(*conf.Replay) },
+		start: func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+			return data_sources.StartReplay(ctx, *conf.Replay, measurements)
+		},
+	},
+}
+
+// dataSink describes a data sink and the config section it is started with. When the config is reloaded, the sink
+// is restarted only if its own section changed. Validate checks the section before anything is restarted, and is nil
+// if there is nothing to check without starting the sink
+type dataSink struct {
+	name     string
+	section  func(conf config.Config) any
+	enabled  func(conf config.Config) bool
+	validate func(conf config.Config) error
+	filter   func(conf config.Config) config.SinkFilter
+	start    func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error)
+}
+
+// settings returns the config section of the sink without its filter. The filter is applied by the processor, so the
+// sink is not restarted when only its filter changes
+func (sink dataSink) settings(conf config.Config) any {
+	section := reflect.ValueOf(sink.section(conf))
+	if section.Kind() != reflect.Pointer || section.IsNil() {
+		return section.Interface()
+	}
+	settings := reflect.New(section.Elem().Type()).Elem()
+	settings.Set(section.Elem())
+	if filter := settings.FieldByName("SinkFilter"); filter.IsValid() {
+		filter.SetZero()
+	}
+	return settings.Interface()
+}
+
+var dataSinks = []dataSink{
+	{
+		name:    "debug",
+		section: func(conf config.Config) any { return conf.Debug },
+		enabled: func(conf config.Config) bool { return conf.Debug },
+		filter:  func(conf config.Config) config.SinkFilter { return config.SinkFilter{} },
+		start: func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error) {
+			measurements, done := data_sinks.Debug()
+			return measurements, done, nil
+		},
+	},
+	{
+		name:    "influxdb_publisher",
+		section: func(conf config.Config) any { return conf.InfluxDBPublisher },
+		enabled: func(conf config.Config) bool {
+			return conf.InfluxDBPublisher != nil && (conf.InfluxDBPublisher.Enabled == nil || *conf.InfluxDBPublisher.Enabled)
+		},
+		validate: func(conf config.Config) error {
+			return data_sinks.ValidateInfluxTags(conf.Tags, conf.InfluxDBPublisher.AdditionalTags)
+		},
+		filter: func(conf config.Config) config.SinkFilter { return conf.InfluxDBPublisher.SinkFilter },
+		start: func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error) {
+			measurements, done := data_sinks.InfluxDB(*conf.InfluxDBPublisher)
+			return measurements, done, nil
+		},
+	},
+	{
+		name:    "influxdb3_publisher",
+		section: func(conf config.Config) any { return conf.InfluxDB3Publisher },
+		enabled: func(conf config.Config) bool {
+			return conf.InfluxDB3Publisher != nil && (conf.InfluxDB3Publisher.Enabled == nil || *conf.InfluxDB3Publisher.Enabled)
+		},
+		validate: func(conf config.Config) error {
+			return data_sinks.ValidateInfluxTags(conf.Tags, conf.InfluxDB3Publisher.AdditionalTags)
+		},
+		filter: func(conf config.Config) config.SinkFilter { return conf.InfluxDB3Publisher.SinkFilter },
+		start: func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error) {
+			measurements, done := data_sinks.InfluxDB3(*conf.InfluxDB3Publisher)
+			return measurements, done, nil
+		},
+	},
+	{
+		name:    "prometheus",
+		section: func(conf config.Config) any { return conf.Prometheus },
+		enabled: func(conf config.Config) bool {
+			return conf.Prometheus != nil && (conf.Prometheus.Enabled == nil || *conf.Prometheus.Enabled)
+		},
+		validate: func(conf config.Config) error { return data_sinks.ValidatePrometheus(*conf.Prometheus) },
+		filter:   func(conf config.Config) config.SinkFilter { return conf.Prometheus.SinkFilter },
+		start: func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error) {
+			return data_sinks.Prometheus(*conf.Prometheus)
+		},
+	},
+	{
+		name:    "mqtt_publisher",
+		section: func(conf config.Config) any { return conf.MQTTPublisher },
+		enabled: func(conf config.Config) bool {
+			return conf.MQTTPublisher != nil && (conf.MQTTPublisher.Enabled == nil || *conf.MQTTPublisher.Enabled)
+		},
+		filter: func(conf config.Config) config.SinkFilter { return conf.MQTTPublisher.SinkFilter },
+		start: func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error) {
+			measurements, done := data_sinks.MQTT(*conf.MQTTPublisher)
+			return measurements, done, nil
+		},
+	},
+}
@@ -0,0 +1,27 @@
+package processor
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+)
+
+func TestDataSinkSettings(t *testing.T) {
+	prometheus := dataSinks[slices.IndexFunc(dataSinks, func(sink dataSink) bool { return sink.name == "prometheus" })]
+	filtered := config.Config{Prometheus: &config.Prometheus{Port: 8081, SinkFilter: config.SinkFilter{ExcludeFields: []string{"diagnostics"}}}}
+	unfiltered := config.Config{Prometheus: &config.Prometheus{Port: 8081}}
+	if !reflect.DeepEqual(prometheus.settings(filtered), prometheus.settings(unfiltered)) {
+		t.Errorf("expected a change of the filter alone not to restart the sink")
+	}
+	if filtered.Prometheus.ExcludeFields == nil {
+		t.Errorf("expected the config to be left intact")
+	}
+	if reflect.DeepEqual(prometheus.settings(unfiltered), prometheus.settings(config.Config{Prometheus: &config.Prometheus{Port: 9091}})) {
+		t.Errorf("expected a change of the port to restart the sink")
+	}
+	if reflect.DeepEqual(prometheus.settings(unfiltered), prometheus.settings(config.Config{})) {
+		t.Errorf("expected disabling the sink to restart it")
+	}
+}
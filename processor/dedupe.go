@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+type dedupeEntry struct {
+	measurement parser.Measurement
+	gateways    map[string]struct{}
+}
+
+// deduplicator merges the copies of the same packet received by multiple gateways or sources. The first copy of a
+// packet starts a window, during which the copy with the best RSSI is kept. When the window expires, the key of the
+// packet is sent to expired and the merged measurement can be taken
+type deduplicator struct {
+	window  time.Duration
+	pending map[string]*dedupeEntry
+	expired chan string
+	stopped chan struct{}
+}
+
+func newDeduplicator(window time.Duration) *deduplicator {
+	return &deduplicator{
+		window:  window,
+		pending: make(map[string]*dedupeEntry),
+		expired: make(chan string),
+		stopped: make(chan struct{}),
+	}
+}
+
+// dedupeKey returns the key identifying the packet, which is the tag, data format and the measurement sequence number,
+// or a hash of the decoded payload for formats without a sequence number (such as format 3). The payload is used
+// instead of the whole advertisement, as the sources may report the other AD structures differently. Returns false if
+// the packet cannot be identified
+func dedupeKey(m parser.Measurement) (string, bool) {
+	mac := strings.ToUpper(strings.ReplaceAll(m.Mac, ":", ""))
+	if m.MeasurementSequenceNumber != nil {
+		return fmt.Sprintf("%s/%s/%d", mac, m.FormatName(), *m.MeasurementSequenceNumber), true
+	}
+	if m.PayloadHash != 0 {
+		return fmt.Sprintf("%s/%s/%016x", mac, m.FormatName(), m.PayloadHash), true
+	}
+	return "", false
+}
+
+// gatewayIdentity returns what identifies the gateway that received the measurement
+func gatewayIdentity(m parser.Measurement) string {
+	if m.GatewayMac != nil {
+		return *m.GatewayMac
+	}
+	return m.SourceType + "/" + m.SourceName
+}
+
+// add adds a copy of a packet. Returns false if the packet cannot be deduplicated, in which case it should be
+// processed as is
+func (d *deduplicator) add(m parser.Measurement) bool {
+	key, ok := dedupeKey(m)
+	if !ok {
+		return false
+	}
+	entry, ok := d.pending[key]
+	if !ok {
+		d.pending[key] = &dedupeEntry{
+			measurement: m,
+			gateways:    map[string]struct{}{gatewayIdentity(m): {}},
+		}
+		time.AfterFunc(d.window, func() {
+			select {
+			case d.expired <- key:
+			case <-d.stopped:
+			}
+		})
+		return true
+	}
+	entry.gateways[gatewayIdentity(m)] = struct{}{}
+	if m.Rssi != nil && (entry.measurement.Rssi == nil || *m.Rssi > *entry.measurement.Rssi) {
+		entry.measurement = m
+	}
+	return true
+}
+
+// take returns the merged measurement of the packet with the given key, and forgets the packet
+func (d *deduplicator) take(key string) (parser.Measurement, bool) {
+	entry, ok := d.pending[key]
+	if !ok {
+		return parser.Measurement{}, false
+	}
+	delete(d.pending, key)
+	gatewayCount := int64(len(entry.gateways))
+	entry.measurement.GatewayCount = &gatewayCount
+	return entry.measurement, true
+}
+
+// takeAll returns the merged measurements of all pending packets, and forgets the packets
+func (d *deduplicator) takeAll() []parser.Measurement {
+	var measurements []parser.Measurement
+	for key := range d.pending {
+		if m, ok := d.take(key); ok {
+			measurements = append(measurements, m)
+		}
+	}
+	return measurements
+}
+
+// stop stops sending the keys of the expired packets, after which the deduplicator is no longer used
+func (d *deduplicator) stop() {
+	close(d.stopped)
+}
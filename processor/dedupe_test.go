@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func dedupeMeasurement(gatewayMac string, sequence, rssi int64) parser.Measurement {
+	m := parser.Measurement{}
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.DataFormat = 5
+	m.GatewayMac = &gatewayMac
+	m.MeasurementSequenceNumber = &sequence
+	m.Rssi = &rssi
+	return m
+}
+
+func TestDeduplicator(t *testing.T) {
+	d := newDeduplicator(time.Hour)
+	d.add(dedupeMeasurement("11:11:11:11:11:11", 100, -80))
+	d.add(dedupeMeasurement("22:22:22:22:22:22", 100, -60))
+	d.add(dedupeMeasurement("33:33:33:33:33:33", 100, -70))
+	d.add(dedupeMeasurement("22:22:22:22:22:22", 100, -90))
+	d.add(dedupeMeasurement("11:11:11:11:11:11", 101, -80))
+
+	key, _ := dedupeKey(dedupeMeasurement("", 100, 0))
+	m, ok := d.take(key)
+	if !ok {
+		t.Fatalf("expected a pending measurement for %s", key)
+	}
+	if *m.GatewayMac != "22:22:22:22:22:22" || *m.Rssi != -60 {
+		t.Errorf("expected the copy with the best RSSI, got gateway %s rssi %d", *m.GatewayMac, *m.Rssi)
+	}
+	if m.GatewayCount == nil || *m.GatewayCount != 3 {
+		t.Errorf("GatewayCount: got %v want %d", m.GatewayCount, 3)
+	}
+	if _, ok := d.take(key); ok {
+		t.Errorf("expected the measurement to be taken only once")
+	}
+	if len(d.pending) != 1 {
+		t.Errorf("expected sequence 101 to be pending, got %d pending", len(d.pending))
+	}
+}
+
+func TestDeduplicator_Expiry(t *testing.T) {
+	d := newDeduplicator(time.Millisecond)
+	d.add(dedupeMeasurement("11:11:11:11:11:11", 100, -80))
+	select {
+	case key := <-d.expired:
+		if _, ok := d.take(key); !ok {
+			t.Errorf("expected a pending measurement for %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("window did not expire")
+	}
+}
+
+func TestDedupeKey(t *testing.T) {
+	// the same format 3 packet as relayed by a gateway, and as reconstructed by bluez_log without the flags
+	gateway, err := parser.Decode("02010611ff990403291a1ece1efc18f94202ca0b53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway.Mac = "aa:bb:cc:dd:ee:ff"
+	bluez, err := parser.Decode("11FF990403291A1ECE1EFC18F94202CA0B53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bluez.Mac = "AA:BB:CC:DD:EE:FF"
+	other, err := parser.Decode("02010611FF990403291A1ECE1EFC18F94202CA0B54")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Mac = "AA:BB:CC:DD:EE:FF"
+
+	key, ok := dedupeKey(gateway)
+	if !ok {
+		t.Fatalf("expected a key for format 3 with a payload")
+	}
+	if bluezKey, _ := dedupeKey(bluez); bluezKey != key {
+		t.Errorf("expected the key to ignore the mac format and the other AD structures, got %s and %s", key, bluezKey)
+	}
+	if otherKey, _ := dedupeKey(other); otherKey == key {
+		t.Errorf("expected different payloads to have different keys")
+	}
+
+	gateway.PayloadHash = 0
+	if _, ok := dedupeKey(gateway); ok {
+		t.Errorf("expected no key without a sequence number or payload")
+	}
+}
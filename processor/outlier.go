@@ -0,0 +1,220 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/common/metrics"
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultOutlierWindow is the default number of recent values per tag and field used for the spike detection
+const defaultOutlierWindow = 10
+
+// madScale scales the median absolute deviation to be comparable to the standard deviation of normally distributed
+// values, and meanADScale does the same for the mean absolute deviation
+const (
+	madScale    = 1.4826
+	meanADScale = 1.2533
+)
+
+type outlierRule struct {
+	field        string
+	index        [2]int
+	min          *float64
+	max          *float64
+	maxRate      *float64
+	madThreshold *float64
+}
+
+// outlierRules are the validated outlier rejection options
+type outlierRules struct {
+	drop   bool
+	window int
+	rules  []outlierRule
+}
+
+// newOutlierRules validates the outlier rejection options. Returns nil if the outlier rejection is not configured
+func newOutlierRules(conf *config.OutlierRejection) (*outlierRules, error) {
+	if conf == nil || len(conf.Fields) == 0 {
+		return nil, nil
+	}
+	r := &outlierRules{window: defaultOutlierWindow}
+	switch conf.Action {
+	case "drop":
+		r.drop = true
+	case "null", "":
+	default:
+		return nil, fmt.Errorf("unrecognized outlier_rejection action: %q", conf.Action)
+	}
+	if conf.Window < 0 {
+		return nil, errors.New("outlier_rejection window cannot be negative")
+	}
+	if conf.Window > 0 {
+		r.window = conf.Window
+	}
+	for field, fieldConf := range conf.Fields {
+		indexes := measurementFields[field]
+		if len(indexes) != 1 {
+			return nil, fmt.Errorf("unrecognized field in outlier_rejection: %q", field)
+		}
+		switch reflect.TypeOf(parser.Measurement{}).Field(indexes[0][0]).Type.Field(indexes[0][1]).Type {
+		case reflect.TypeOf((*float64)(nil)), reflect.TypeOf((*int64)(nil)):
+		default:
+			return nil, fmt.Errorf("field %q in outlier_rejection is not numeric", field)
+		}
+		if fieldConf.Min != nil && fieldConf.Max != nil && *fieldConf.Min > *fieldConf.Max {
+			return nil, fmt.Errorf("min is greater than max for %q in outlier_rejection", field)
+		}
+		if fieldConf.MaxRate != nil && *fieldConf.MaxRate <= 0 {
+			return nil, fmt.Errorf("max_rate must be positive for %q in outlier_rejection", field)
+		}
+		if fieldConf.MADThreshold != nil && *fieldConf.MADThreshold <= 0 {
+			return nil, fmt.Errorf("mad_threshold must be positive for %q in outlier_rejection", field)
+		}
+		r.rules = append(r.rules, outlierRule{
+			field:        field,
+			index:        indexes[0],
+			min:          fieldConf.Min,
+			max:          fieldConf.Max,
+			maxRate:      fieldConf.MaxRate,
+			madThreshold: fieldConf.MADThreshold,
+		})
+	}
+	slices.SortFunc(r.rules, func(a, b outlierRule) int { return slices.Compare(a.index[:], b.index[:]) })
+	return r, nil
+}
+
+type outlierFieldState struct {
+	accepted     bool
+	lastValue    float64
+	lastTime     time.Time
+	recentValues []float64
+}
+
+// outlierTracker keeps the recent values of each tag for the rate of change and spike detection
+type outlierTracker struct {
+	tags map[string]map[string]*outlierFieldState
+}
+
+func newOutlierTracker() *outlierTracker {
+	return &outlierTracker{tags: make(map[string]map[string]*outlierFieldState)}
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// isSpike checks whether the value deviates from the median of the recent values by more than threshold times the
+// scaled median absolute deviation. The mean absolute deviation is used when more than half of the recent values are
+// equal, and the check is skipped when all of them are
+func isSpike(recentValues []float64, value, threshold float64) bool {
+	m := median(recentValues)
+	deviations := make([]float64, len(recentValues))
+	for i, v := range recentValues {
+		deviations[i] = math.Abs(v - m)
+	}
+	spread := median(deviations) * madScale
+	if spread == 0 {
+		var sum float64
+		for _, d := range deviations {
+			sum += d
+		}
+		spread = sum / float64(len(deviations)) * meanADScale
+	}
+	return spread > 0 && math.Abs(value-m)/spread > threshold
+}
+
+// check rejects the implausible values of the measurement, either removing them or rejecting the whole measurement.
+// Returns false if the measurement should be dropped. All the fields are checked even when dropping, so that the state
+// of each field follows the received values
+func (t *outlierTracker) check(m *parser.Measurement, rules *outlierRules) bool {
+	if rules == nil {
+		return true
+	}
+	now := time.Now()
+	if m.ReceiveTime != nil {
+		now = time.UnixMilli(*m.ReceiveTime)
+	}
+	fields := t.tags[m.Mac]
+	if fields == nil {
+		if len(t.tags) >= maxTrackedTags {
+			t.tags = make(map[string]map[string]*outlierFieldState)
+		}
+		fields = make(map[string]*outlierFieldState)
+		t.tags[m.Mac] = fields
+	}
+	v := reflect.ValueOf(m).Elem()
+	keep := true
+	for _, rule := range rules.rules {
+		field := v.Field(rule.index[0]).Field(rule.index[1])
+		if field.IsNil() {
+			continue
+		}
+		var value float64
+		if field.Elem().CanFloat() {
+			value = field.Elem().Float()
+		} else {
+			value = float64(field.Elem().Int())
+		}
+		state := fields[rule.field]
+		if state == nil {
+			state = &outlierFieldState{}
+			fields[rule.field] = state
+		}
+
+		reason := ""
+		if (rule.min != nil && value < *rule.min) || (rule.max != nil && value > *rule.max) || math.IsNaN(value) {
+			reason = "bounds"
+		} else {
+			// the rate is not checked for a measurement received at the same time as the last one, as it is undefined
+			if elapsed := now.Sub(state.lastTime).Seconds(); rule.maxRate != nil && state.accepted && elapsed > 0 {
+				if math.Abs(value-state.lastValue)/elapsed > *rule.maxRate {
+					reason = "rate"
+				}
+			}
+			if reason == "" && rule.madThreshold != nil && len(state.recentValues) >= rules.window {
+				if isSpike(state.recentValues, value, *rule.madThreshold) {
+					reason = "spike"
+				}
+			}
+			// values within the bounds are kept in the window even when rejected, so that the window follows a
+			// persistent change in the values
+			state.recentValues = append(state.recentValues, value)
+			if len(state.recentValues) > rules.window {
+				state.recentValues = state.recentValues[len(state.recentValues)-rules.window:]
+			}
+		}
+
+		if reason == "" {
+			state.accepted = true
+			state.lastValue = value
+			state.lastTime = now
+			continue
+		}
+		action := "nulled"
+		if rules.drop {
+			action = "dropped"
+		}
+		metrics.OutlierRejections.WithLabelValues(rule.field, reason, action).Inc()
+		log.Debug().Str("mac", m.Mac).Str("field", rule.field).Float64("value", value).Str("reason", reason).Str("action", action).Msg("Outlier rejected")
+		if rules.drop {
+			keep = false
+		} else {
+			field.SetZero()
+		}
+	}
+	return keep
+}
@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func outlierMeasurement(receiveTime int64, temperature, pressure float64) *parser.Measurement {
+	m := &parser.Measurement{}
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.ReceiveTime = &receiveTime
+	m.Temperature = &temperature
+	m.Pressure = &pressure
+	return m
+}
+
+func TestOutlierTracker_Bounds(t *testing.T) {
+	rules, err := newOutlierRules(&config.OutlierRejection{Fields: map[string]config.OutlierField{
+		"temperature": {Min: float(-35), Max: float(85)},
+		"pressure":    {Min: float(50000)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newOutlierTracker()
+
+	m := outlierMeasurement(0, -40, 0)
+	if !tracker.check(m, rules) {
+		t.Fatalf("expected the measurement to be kept when nulling the values")
+	}
+	if m.Temperature != nil || m.Pressure != nil {
+		t.Errorf("expected the values out of bounds to be removed, got %v %v", m.Temperature, m.Pressure)
+	}
+
+	m = outlierMeasurement(1000, 21.5, 100000)
+	if !tracker.check(m, rules) || m.Temperature == nil || m.Pressure == nil {
+		t.Errorf("expected the plausible values to be kept")
+	}
+
+	rules.drop = true
+	if tracker.check(outlierMeasurement(2000, 21.5, 0), rules) {
+		t.Errorf("expected the measurement to be dropped")
+	}
+}
+
+func TestOutlierTracker_Rate(t *testing.T) {
+	rules, err := newOutlierRules(&config.OutlierRejection{Fields: map[string]config.OutlierField{
+		"temperature": {MaxRate: float(0.5)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newOutlierTracker()
+
+	for i, test := range []struct {
+		receiveTime int64
+		temperature float64
+		expected    bool
+	}{
+		{0, 20, true},
+		{1000, 20.4, true},
+		{2000, 25, false},   // 4.6 degrees in a second
+		{3000, 20.6, true},  // compared to the last accepted value
+		{3000, 25, true},    // no rate for the same receive time
+		{3500, 20.6, false}, // 4.4 degrees in half a second, compared to 25
+		{63000, 30, true},   // slow enough over a minute
+	} {
+		m := outlierMeasurement(test.receiveTime, test.temperature, 100000)
+		tracker.check(m, rules)
+		if (m.Temperature != nil) != test.expected {
+			t.Errorf("measurement %d: expected kept to be %t", i, test.expected)
+		}
+	}
+}
+
+func TestOutlierTracker_DropUpdatesAllFields(t *testing.T) {
+	rules, err := newOutlierRules(&config.OutlierRejection{Action: "drop", Fields: map[string]config.OutlierField{
+		"temperature": {Max: float(85)},
+		"pressure":    {MaxRate: float(100)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newOutlierTracker()
+
+	if !tracker.check(outlierMeasurement(0, 20, 100000), rules) {
+		t.Fatalf("expected the first measurement to be kept")
+	}
+	// the temperature is rejected, but the pressure still becomes the last accepted pressure
+	if tracker.check(outlierMeasurement(1000, 90, 100050), rules) {
+		t.Errorf("expected the measurement to be dropped")
+	}
+	// 130 Pa in a second compared to the dropped measurement, 90 Pa/s compared to the first one
+	if tracker.check(outlierMeasurement(2000, 20, 100180), rules) {
+		t.Errorf("expected the rate to be compared to the pressure of the dropped measurement")
+	}
+}
+
+func TestOutlierTracker_Spike(t *testing.T) {
+	rules, err := newOutlierRules(&config.OutlierRejection{Window: 5, Fields: map[string]config.OutlierField{
+		"temperature": {MADThreshold: float(5)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newOutlierTracker()
+
+	for i, temperature := range []float64{20.1, 20.2, 20.1, 20.3, 20.2} {
+		m := outlierMeasurement(int64(i)*1000, temperature, 100000)
+		if tracker.check(m, rules); m.Temperature == nil {
+			t.Fatalf("expected the value %d to be kept", i)
+		}
+	}
+	m := outlierMeasurement(5000, 35, 100000)
+	if tracker.check(m, rules); m.Temperature != nil {
+		t.Errorf("expected the spike to be removed")
+	}
+	m = outlierMeasurement(6000, 20.25, 100000)
+	if tracker.check(m, rules); m.Temperature == nil {
+		t.Errorf("expected the value after the spike to be kept")
+	}
+
+	// a persistent change is accepted once it dominates the window
+	kept := false
+	for i := 0; i < 5 && !kept; i++ {
+		m := outlierMeasurement(int64(7+i)*1000, 10, 100000)
+		tracker.check(m, rules)
+		kept = m.Temperature != nil
+	}
+	if !kept {
+		t.Errorf("expected a persistent change to be eventually accepted")
+	}
+}
+
+func TestOutlierRules_Invalid(t *testing.T) {
+	if rules, err := newOutlierRules(nil); rules != nil || err != nil {
+		t.Errorf("expected no rules without the config, got %v %v", rules, err)
+	}
+	configs := map[string]config.OutlierRejection{
+		"unknown action":    {Action: "ignore", Fields: map[string]config.OutlierField{"temperature": {}}},
+		"unknown field":     {Fields: map[string]config.OutlierField{"temperatur": {}}},
+		"group":             {Fields: map[string]config.OutlierField{"basic": {}}},
+		"not numeric":       {Fields: map[string]config.OutlierField{"macMismatch": {}}},
+		"min above max":     {Fields: map[string]config.OutlierField{"temperature": {Min: float(10), Max: float(0)}}},
+		"negative max_rate": {Fields: map[string]config.OutlierField{"temperature": {MaxRate: float(-1)}}},
+		"negative window":   {Window: -1, Fields: map[string]config.OutlierField{"temperature": {}}},
+	}
+	for name, conf := range configs {
+		if _, err := newOutlierRules(&conf); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOutlierTracker_MaxTags(t *testing.T) {
+	rules, err := newOutlierRules(&config.OutlierRejection{Fields: map[string]config.OutlierField{
+		"temperature": {Min: float(-35), Max: float(85)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newOutlierTracker()
+	for i := 0; i <= maxTrackedTags; i++ {
+		m := outlierMeasurement(0, 21.5, 100000)
+		m.Mac = fmt.Sprintf("AA:BB:CC:DD:%02X:%02X", i>>8, i&0xff)
+		tracker.check(m, rules)
+	}
+	if len(tracker.tags) != 1 {
+		t.Errorf("expected the tags to be forgotten at the limit, got %d tags", len(tracker.tags))
+	}
+}
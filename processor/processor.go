@@ -1,145 +1,458 @@
 package processor
 
 import (
-	"fmt"
+	"context"
+	"reflect"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/Scrin/RuuviBridge/common/metrics"
 	"github.com/Scrin/RuuviBridge/common/version"
 	"github.com/Scrin/RuuviBridge/config"
-	"github.com/Scrin/RuuviBridge/data_sinks"
 	"github.com/Scrin/RuuviBridge/data_sources"
 	"github.com/Scrin/RuuviBridge/parser"
 	"github.com/Scrin/RuuviBridge/value_calculator"
 	"github.com/rs/zerolog/log"
 )
 
-func Run(config config.Config) {
-	log.Info().Str("version", version.Version).Msg("RuuviBridge starting up")
-	measurements := make(chan parser.Measurement, 1024)
-	var sinks []chan<- parser.Measurement
-
-	extendedValues := true     // default
-	includeUnofficial := false // default
-	filterMap := make(map[string]any)
-	allowlist := false
-	denylist := false
-	namedOnly := false
-	if config.Processing != nil {
-		processing := config.Processing
-		if processing.ExtendedValues != nil {
-			extendedValues = *processing.ExtendedValues
-		}
-		includeUnofficial = processing.IncludeUnofficial
-		switch processing.FilterMode {
-		case "allowlist":
-			allowlist = true
-			if len(config.Processing.FilterList) == 0 {
-				log.Fatal().Msg("filter_mode configured as allowlist but no allowed tags configured!")
-			}
-		case "denylist":
-			denylist = true
-			if len(config.Processing.FilterList) == 0 {
-				log.Fatal().Msg("filter_mode configured as denylist but no denied tags configured!")
-			}
-		case "named":
-			namedOnly = true
-			if len(config.TagNames) == 0 {
-				log.Fatal().Msg("filter_mode configured as named but no tag names configured!")
-			}
-		case "none":
-		default:
-			log.Fatal().Str("filter_mode", processing.FilterMode).Msg("Unrecognized filter_mode")
-		}
-		for _, mac := range config.Processing.FilterList {
-			formattedMac := strings.ToUpper(strings.ReplaceAll(mac, ":", ""))
-			filterMap[formattedMac] = struct{}{}
-		}
+// optionalString returns nil for an empty string
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
 	}
+	return &s
+}
 
-	log.Info().Msg("Starting data sources")
-	datasourcesStarted := false
-	if config.GatewayPolling != nil && (config.GatewayPolling.Enabled == nil || *config.GatewayPolling.Enabled) {
-		stop := data_sources.StartGatewayPolling(*config.GatewayPolling, measurements)
-		defer func() { stop <- true }()
-		datasourcesStarted = true
-	}
-	if config.MQTTListener != nil && (config.MQTTListener.Enabled == nil || *config.MQTTListener.Enabled) {
-		stop := data_sources.StartMQTTListener(*config.MQTTListener, measurements)
-		defer func() { stop <- true }()
-		datasourcesStarted = true
-	}
-	if config.HTTPListener != nil && (config.HTTPListener.Enabled == nil || *config.HTTPListener.Enabled) {
-		stop := data_sources.StartHTTPListener(*config.HTTPListener, measurements)
-		defer func() { stop <- true }()
-		datasourcesStarted = true
-	}
-	if !datasourcesStarted {
-		log.Fatal().Msg("No datasources configured! Please check the config.")
+func shutdownTimeout(conf config.Config) time.Duration {
+	if conf.ShutdownTimeout > 0 {
+		return conf.ShutdownTimeout
 	}
+	return 5 * time.Second // default
+}
 
-	log.Info().Msg("Starting data sinks")
-	datasinksStarted := false
-	if config.Debug {
-		sinks = append(sinks, data_sinks.Debug())
-		datasinksStarted = true
+// Run runs the bridge until the context is cancelled, after which the sources are stopped, the received measurements
+// are processed and the sinks are flushed, within the configured shutdown timeout. The configs received from reloads
+// are applied without a restart, only the sources and sinks whose own config section changed are restarted
+func Run(ctx context.Context, conf config.Config, reloads <-chan config.Config) {
+	log.Info().Str("version", version.Version).Msg("RuuviBridge starting up")
+	measurements := make(chan parser.Measurement, 1024)
+
+	s, err := newSettings(conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid config")
 	}
-	if config.InfluxDBPublisher != nil && (config.InfluxDBPublisher.Enabled == nil || *config.InfluxDBPublisher.Enabled) {
-		sinks = append(sinks, data_sinks.InfluxDB(*config.InfluxDBPublisher))
-		datasinksStarted = true
+	if err := parser.SetEncryptionKeys(s.encryptionKeys); err != nil {
+		log.Fatal().Err(err).Msg("Invalid encryption key")
 	}
-	if config.InfluxDB3Publisher != nil && (config.InfluxDB3Publisher.Enabled == nil || *config.InfluxDB3Publisher.Enabled) {
-		sinks = append(sinks, data_sinks.InfluxDB3(*config.InfluxDB3Publisher))
-		datasinksStarted = true
+	if !slices.ContainsFunc(dataSources, func(source dataSource) bool { return source.enabled(conf) }) {
+		log.Fatal().Msg("No datasources configured! Please check the config.")
 	}
-	if config.Prometheus != nil && (config.Prometheus.Enabled == nil || *config.Prometheus.Enabled) {
-		sinks = append(sinks, data_sinks.Prometheus(*config.Prometheus))
-		datasinksStarted = true
+	if !slices.ContainsFunc(dataSinks, func(sink dataSink) bool { return sink.enabled(conf) }) {
+		log.Fatal().Msg("No data consumers/sinks configured! Please check the config.")
 	}
-	if config.MQTTPublisher != nil && (config.MQTTPublisher.Enabled == nil || *config.MQTTPublisher.Enabled) {
-		sinks = append(sinks, data_sinks.MQTT(*config.MQTTPublisher))
-		datasinksStarted = true
+
+	// a source with a nil cancel and a sink with nil measurements are stopping, or not running if done is nil as well
+	type runningSource struct {
+		cancel   context.CancelFunc
+		done     <-chan struct{}
+		previous *config.Config // the previous config the source runs with, when the current config failed to start
 	}
-	if !datasinksStarted {
-		log.Fatal().Msg("No data consumers/sinks configured! Please check the config.")
+	type runningSink struct {
+		measurements chan<- parser.Measurement
+		done         <-chan struct{}
+		previous     *config.Config // the previous config the sink runs with, when the current config failed to start
 	}
+	sources := make([]runningSource, len(dataSources))
+	sinks := make([]runningSink, len(dataSinks))
+	sequences := newSequenceTracker()
+	outliers := newOutlierTracker()
 
-	log.Info().Msg("Starting processing")
-	for measurement := range measurements {
-		_, isOnList := filterMap[strings.ReplaceAll(measurement.Mac, ":", "")]
-		if denylist && isOnList {
+	// accept applies the filters to each received copy of a measurement, returning whether it should be processed
+	accept := func(measurement *parser.Measurement) bool {
+		_, isOnList := s.filterMap[strings.ReplaceAll(measurement.Mac, ":", "")]
+		if s.denylist && isOnList {
 			log.Trace().Str("mac", measurement.Mac).Str("filter_mode", "denylist").Msg("Measurement dropped")
-			continue
+			return false
 		}
-		if allowlist && !isOnList {
+		if s.allowlist && !isOnList {
 			log.Trace().Str("mac", measurement.Mac).Str("filter_mode", "allowlist").Msg("Measurement dropped")
-			continue
+			return false
+		}
+
+		if s.gatewayAllowlist || s.gatewayDenylist {
+			gatewayMac := ""
+			if measurement.GatewayMac != nil {
+				gatewayMac = strings.ReplaceAll(*measurement.GatewayMac, ":", "")
+			}
+			_, isOnList := s.gatewayFilterMap[gatewayMac]
+			if s.gatewayDenylist && isOnList {
+				log.Trace().Str("mac", measurement.Mac).Str("gateway_mac", gatewayMac).Str("gateway_filter_mode", "denylist").Msg("Measurement dropped")
+				return false
+			}
+			if s.gatewayAllowlist && !isOnList {
+				log.Trace().Str("mac", measurement.Mac).Str("gateway_mac", gatewayMac).Str("gateway_filter_mode", "allowlist").Msg("Measurement dropped")
+				return false
+			}
 		}
 
-		if slices.Contains(config.Processing.DisableFormats, fmt.Sprintf("%X", measurement.DataFormat)) {
-			log.Trace().Str("mac", measurement.Mac).Str("data_format", fmt.Sprintf("%X", measurement.DataFormat)).Msg("Measurement dropped")
-			continue
+		if slices.Contains(s.disabledFormats, measurement.FormatName()) {
+			log.Trace().Str("mac", measurement.Mac).Str("data_format", measurement.FormatName()).Msg("Measurement dropped")
+			return false
 		}
 
-		name := config.TagNames[strings.ReplaceAll(measurement.Mac, ":", "")]
+		if measurement.EmbeddedMac != nil && s.macMismatch != "none" {
+			reportedMac := strings.ToUpper(strings.ReplaceAll(measurement.Mac, ":", ""))
+			embeddedMac := strings.ReplaceAll(*measurement.EmbeddedMac, ":", "")
+			mismatch := !strings.HasSuffix(reportedMac, embeddedMac)
+			measurement.MacMismatch = &mismatch
+			if mismatch {
+				action := "flagged"
+				if s.macMismatch == "drop" {
+					action = "dropped"
+				}
+				metrics.MacMismatches.WithLabelValues(action).Inc()
+				log.Debug().Str("mac", measurement.Mac).Str("embedded_mac", *measurement.EmbeddedMac).Str("action", action).Msg("MAC address mismatch")
+				if s.macMismatch == "drop" {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// process processes the measurement and passes it to the sinks
+	process := func(measurement parser.Measurement) {
+		tag := s.tags[strings.ToUpper(strings.ReplaceAll(measurement.Mac, ":", ""))]
+		name := tag.Name
+		if name == "" {
+			name = s.tagNames[strings.ReplaceAll(measurement.Mac, ":", "")]
+		}
 		if name != "" {
 			measurement.Name = &name
-		} else if namedOnly {
+		} else if s.namedOnly {
 			log.Trace().Str("mac", measurement.Mac).Str("filter_mode", "named").Msg("Measurement dropped")
-			continue
+			return
 		}
 
-		if extendedValues {
+		measurement.Location = optionalString(tag.Location)
+		measurement.Room = optionalString(tag.Room)
+		measurement.Floor = optionalString(tag.Floor)
+		measurement.Owner = optionalString(tag.Owner)
+		if len(tag.Metadata) > 0 {
+			measurement.Metadata = tag.Metadata
+		}
+
+		sequences.update(&measurement)
+
+		if calibration, ok := s.calibrations[strings.ToUpper(strings.ReplaceAll(measurement.Mac, ":", ""))]; ok {
+			calibration.calibrate(&measurement)
+		}
+
+		if !outliers.check(&measurement, s.outlierRules) {
+			log.Trace().Str("mac", measurement.Mac).Str("outlier_rejection", "drop").Msg("Measurement dropped")
+			return
+		}
+
+		if s.extendedValues {
 			value_calculator.CalcExtendedValues(&measurement)
 		}
 
-		if !includeUnofficial {
+		if !s.includeUnofficial {
 			measurement.UnofficialData = parser.UnofficialData{}
 		}
 
-		for _, sink := range sinks {
-			sink <- measurement
+		for i, sink := range sinks {
+			if sink.measurements == nil {
+				continue
+			}
+			if filtered, ok := s.sinkFilters[i].apply(measurement); ok {
+				sink.measurements <- filtered
+			} else {
+				log.Trace().Str("mac", measurement.Mac).Str("sink", dataSinks[i].name).Msg("Measurement filtered out for the sink")
+			}
 		}
 		log.Trace().Str("mac", measurement.Mac).Msg("Measurement processed")
 	}
+
+	var dedupe *deduplicator
+	var expired <-chan string // nil if deduplication is disabled
+	startDedupe := func() {
+		if s.dedupeWindow > 0 {
+			dedupe = newDeduplicator(s.dedupeWindow)
+			expired = dedupe.expired
+		}
+	}
+	stopDedupe := func() {
+		if dedupe != nil {
+			for _, measurement := range dedupe.takeAll() {
+				process(measurement)
+			}
+			dedupe.stop()
+			dedupe = nil
+			expired = nil
+		}
+	}
+	handle := func(measurement parser.Measurement) {
+		if !accept(&measurement) {
+			return
+		}
+		if dedupe == nil || !dedupe.add(measurement) {
+			process(measurement)
+		}
+	}
+
+	// waitFor waits for a source or a sink to stop, processing the measurements received and deduplicated meanwhile.
+	// Returns false if the context expired first
+	waitFor := func(ctx context.Context, done <-chan struct{}) bool {
+		for {
+			select {
+			case <-done:
+				return true
+			case measurement := <-measurements:
+				handle(measurement)
+			case key := <-expired:
+				if measurement, ok := dedupe.take(key); ok {
+					process(measurement)
+				}
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	startSource := func(sourceConf config.Config, i int) error {
+		if !dataSources[i].enabled(sourceConf) {
+			return nil
+		}
+		sourceCtx, cancel := context.WithCancel(ctx)
+		done, err := dataSources[i].start(sourceCtx, sourceConf, measurements)
+		if err != nil {
+			cancel()
+			return err
+		}
+		sources[i] = runningSource{cancel: cancel, done: done}
+		return nil
+	}
+	// stopSource stops the source, returning false if it did not stop in time. Such a source is kept as stopping, so
+	// that it is waited for again instead of being started twice
+	stopSource := func(ctx context.Context, i int) bool {
+		if sources[i].done == nil {
+			return true
+		}
+		if sources[i].cancel != nil {
+			sources[i].cancel()
+			sources[i].cancel = nil
+		}
+		if !waitFor(ctx, sources[i].done) {
+			log.Warn().Str("source", dataSources[i].name).Msg("Timed out waiting for the data source to stop")
+			return false
+		}
+		sources[i] = runningSource{}
+		return true
+	}
+	startSink := func(sinkConf config.Config, i int) error {
+		if !dataSinks[i].enabled(sinkConf) {
+			return nil
+		}
+		sinkMeasurements, done, err := dataSinks[i].start(sinkConf)
+		if err != nil {
+			return err
+		}
+		sinks[i] = runningSink{measurements: sinkMeasurements, done: done}
+		return nil
+	}
+	// stopSink stops the sink, returning false if it did not flush in time. Such a sink is kept as stopping, so that
+	// it is waited for again instead of being started twice
+	stopSink := func(ctx context.Context, i int) bool {
+		sink := sinks[i]
+		if sink.done == nil {
+			return true
+		}
+		if sink.measurements != nil {
+			sinks[i].measurements = nil // no longer passed the measurements processed while waiting
+			close(sink.measurements)
+		}
+		if !waitFor(ctx, sink.done) {
+			log.Warn().Str("sink", dataSinks[i].name).Msg("Timed out waiting for the data sink to flush")
+			return false
+		}
+		sinks[i] = runningSink{}
+		return true
+	}
+	var stopRecorder func()
+	startRecorder := func() error {
+		if conf.Recorder != nil && (conf.Recorder.Enabled == nil || *conf.Recorder.Enabled) {
+			stop, err := data_sources.StartRecorder(*conf.Recorder)
+			if err != nil {
+				return err
+			}
+			stopRecorder = stop
+		}
+		return nil
+	}
+	defer func() {
+		if stopRecorder != nil {
+			stopRecorder()
+		}
+	}()
+
+	// reload applies the new config, restarting the sources and sinks whose config section changed, as well as the ones
+	// that previously failed to stop or start. A source that fails to start with the new config is started with the
+	// previous config, if possible. An invalid config is ignored, keeping the current config
+	reload := func(newConf config.Config) {
+		reloaded, err := newSettings(newConf)
+		if err != nil {
+			log.Error().Err(err).Msg("Invalid config, keeping the current config")
+			return
+		}
+		if !slices.ContainsFunc(dataSources, func(source dataSource) bool { return source.enabled(newConf) }) {
+			log.Error().Msg("No datasources configured, keeping the current config")
+			return
+		}
+		if !slices.ContainsFunc(dataSinks, func(sink dataSink) bool { return sink.enabled(newConf) }) {
+			log.Error().Msg("No data consumers/sinks configured, keeping the current config")
+			return
+		}
+		if err := parser.SetEncryptionKeys(reloaded.encryptionKeys); err != nil {
+			log.Error().Err(err).Msg("Invalid encryption key, keeping the current config")
+			return
+		}
+		oldConf := conf
+		conf = newConf
+		stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout(conf))
+		defer cancel()
+
+		dedupeChanged := reloaded.dedupeWindow != s.dedupeWindow
+		if dedupeChanged {
+			stopDedupe() // the pending measurements are processed with the old settings
+		}
+		s = reloaded
+		if dedupeChanged {
+			startDedupe()
+		}
+
+		if !reflect.DeepEqual(oldConf.Recorder, conf.Recorder) {
+			log.Info().Msg("Recorder config changed, restarting the recorder")
+			if stopRecorder != nil {
+				stopRecorder()
+				stopRecorder = nil
+			}
+			if err := startRecorder(); err != nil {
+				log.Error().Err(err).Msg("Failed to start the recorder")
+			}
+		}
+		for i, source := range dataSources {
+			changed := !reflect.DeepEqual(source.section(oldConf), source.section(conf))
+			if changed {
+				log.Info().Str("source", source.name).Msg("Data source config changed, restarting the data source")
+			} else if (sources[i].cancel != nil && sources[i].previous == nil) || !source.enabled(oldConf) {
+				continue // running as configured
+			}
+			previousConf := oldConf
+			if sources[i].previous != nil {
+				previousConf = *sources[i].previous
+			}
+			if !stopSource(stopCtx, i) {
+				log.Error().Str("source", source.name).Msg("Data source is still stopping, it is restarted on the next reload")
+				continue
+			}
+			if err := startSource(conf, i); err != nil {
+				// keeps receiving data with the previous config, such as when the new port is already in use
+				if source.enabled(previousConf) && startSource(previousConf, i) == nil {
+					sources[i].previous = &previousConf
+					log.Error().Str("source", source.name).Err(err).Msg("Failed to start the data source, running it with the previous config until the next reload")
+				} else {
+					log.Error().Str("source", source.name).Err(err).Msg("Failed to start the data source, it is retried on the next reload")
+				}
+			}
+		}
+		for i, sink := range dataSinks {
+			changed := !reflect.DeepEqual(sink.settings(oldConf), sink.settings(conf))
+			if changed {
+				log.Info().Str("sink", sink.name).Msg("Data sink config changed, restarting the data sink")
+			} else if (sinks[i].measurements != nil && sinks[i].previous == nil) || !sink.enabled(oldConf) {
+				continue // running as configured
+			}
+			previousConf := oldConf
+			if sinks[i].previous != nil {
+				previousConf = *sinks[i].previous
+			}
+			if !stopSink(stopCtx, i) {
+				log.Error().Str("sink", sink.name).Msg("Data sink is still flushing, it is restarted on the next reload")
+				continue
+			}
+			if err := startSink(conf, i); err != nil {
+				// keeps passing data with the previous config, such as when the new port is already in use
+				if sink.enabled(previousConf) && startSink(previousConf, i) == nil {
+					sinks[i].previous = &previousConf
+					log.Error().Str("sink", sink.name).Err(err).Msg("Failed to start the data sink, running it with the previous config until the next reload")
+				} else {
+					log.Error().Str("sink", sink.name).Err(err).Msg("Failed to start the data sink, it is retried on the next reload")
+				}
+			}
+		}
+		log.Info().Msg("Config reloaded")
+	}
+
+	if err := startRecorder(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to start the recorder")
+	}
+	log.Info().Msg("Starting data sources")
+	for i, source := range dataSources {
+		if err := startSource(conf, i); err != nil {
+			log.Fatal().Str("source", source.name).Err(err).Msg("Failed to start the data source")
+		}
+	}
+	log.Info().Msg("Starting data sinks")
+	for i, sink := range dataSinks {
+		if err := startSink(conf, i); err != nil {
+			log.Fatal().Str("sink", sink.name).Err(err).Msg("Failed to start the data sink")
+		}
+	}
+
+	log.Info().Msg("Starting processing")
+	startDedupe()
+	for running := true; running; {
+		select {
+		case measurement := <-measurements:
+			handle(measurement)
+		case key := <-expired:
+			if measurement, ok := dedupe.take(key); ok {
+				process(measurement)
+			}
+		case newConf := <-reloads:
+			reload(newConf)
+		case <-ctx.Done():
+			running = false
+		}
+	}
+
+	log.Info().Dur("shutdown_timeout", shutdownTimeout(conf)).Msg("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout(conf))
+	defer cancel()
+	for i := range sources {
+		stopSource(shutdownCtx, i)
+	}
+	for draining := true; draining; {
+		select {
+		case measurement := <-measurements:
+			handle(measurement)
+		default:
+			draining = false
+		}
+	}
+	stopDedupe()
+	stopping := slices.Clone(sinks)
+	for i, sink := range sinks {
+		if sink.measurements != nil {
+			sinks[i] = runningSink{}
+			close(sink.measurements) // the sinks are flushed in parallel
+		}
+	}
+	for i, sink := range stopping {
+		if sink.done != nil && !waitFor(shutdownCtx, sink.done) {
+			log.Warn().Str("sink", dataSinks[i].name).Msg("Timed out waiting for the data sink to flush")
+		}
+	}
+	log.Info().Msg("RuuviBridge stopped")
 }
@@ -0,0 +1,392 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// fakeBridge replaces the data sources and sinks with fakes that record when they are started and stopped, and the
+// measurements the sinks receive. The sources use the http_listener and mqtt_listener sections of the config and the
+// sinks use the prometheus and mqtt_publisher sections, the port of each is used to tell the configs apart
+type fakeBridge struct {
+	mu     sync.Mutex
+	events []string
+	busy   map[int]bool             // ports that fail to start
+	emit   map[string][]string      // macs of the measurements each source sends when stopped
+	hang   map[string]chan struct{} // components that do not stop until the channel is closed
+	logs   chan string
+
+	reloads chan config.Config
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+func (b *fakeBridge) record(format string, args ...any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, fmt.Sprintf(format, args...))
+}
+
+// take returns the events recorded since the previous call
+func (b *fakeBridge) take() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := b.events
+	b.events = nil
+	return events
+}
+
+func (b *fakeBridge) setBusy(port int, busy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.busy[port] = busy
+}
+
+func (b *fakeBridge) isBusy(port int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.busy[port]
+}
+
+func (b *fakeBridge) hanging(name string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hang[name]
+}
+
+func (b *fakeBridge) Write(p []byte) (int, error) {
+	select {
+	case b.logs <- string(p):
+	default:
+	}
+	return len(p), nil
+}
+
+// waitLog waits for a log message containing one of the given strings
+func (b *fakeBridge) waitLog(t *testing.T, messages ...string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-b.logs:
+			if slices.ContainsFunc(messages, func(message string) bool { return strings.Contains(line, message) }) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for the log message %q", messages)
+		}
+	}
+}
+
+func (b *fakeBridge) source(name string, port func(conf config.Config) int, section func(conf config.Config) any) dataSource {
+	return dataSource{
+		name:     name,
+		section:  section,
+		enabled:  func(conf config.Config) bool { return port(conf) != 0 },
+		validate: func(conf config.Config) error { return nil },
+		start: func(ctx context.Context, conf config.Config, measurements chan<- parser.Measurement) (<-chan struct{}, error) {
+			b.record("start %s %d", name, port(conf))
+			if b.isBusy(port(conf)) {
+				return nil, errors.New("port in use")
+			}
+			done := make(chan struct{})
+			go func() {
+				<-ctx.Done()
+				if hang := b.hanging(name); hang != nil {
+					<-hang
+				}
+				for _, mac := range b.emit[name] {
+					measurement := parser.Measurement{}
+					measurement.Mac = mac
+					measurements <- measurement
+				}
+				b.record("stop %s", name)
+				close(done)
+			}()
+			return done, nil
+		},
+	}
+}
+
+func (b *fakeBridge) sink(name string, port func(conf config.Config) int, section func(conf config.Config) any, filter func(conf config.Config) config.SinkFilter) dataSink {
+	return dataSink{
+		name:    name,
+		section: section,
+		enabled: func(conf config.Config) bool { return port(conf) != 0 },
+		filter:  filter,
+		start: func(conf config.Config) (chan<- parser.Measurement, <-chan struct{}, error) {
+			b.record("start %s %d", name, port(conf))
+			if b.isBusy(port(conf)) {
+				return nil, nil, errors.New("port in use")
+			}
+			measurements := make(chan parser.Measurement, 1024)
+			done := make(chan struct{})
+			go func() {
+				for measurement := range measurements {
+					b.record("receive %s %s", name, measurement.Mac)
+				}
+				if hang := b.hanging(name); hang != nil {
+					<-hang
+				}
+				b.record("stop %s", name)
+				close(done)
+			}()
+			return measurements, done, nil
+		},
+	}
+}
+
+// startFakeBridge runs the bridge with the fake sources and sinks, returning once the processing has started
+func startFakeBridge(t *testing.T, conf config.Config, b *fakeBridge) {
+	t.Helper()
+	if b.busy == nil {
+		b.busy = make(map[int]bool)
+	}
+	b.logs = make(chan string, 4096)
+	b.reloads = make(chan config.Config)
+	b.stopped = make(chan struct{})
+
+	originalSources, originalSinks, originalLogger := dataSources, dataSinks, log.Logger
+	dataSources = []dataSource{
+		b.source("http_listener",
+			func(conf config.Config) int {
+				if conf.HTTPListener == nil {
+					return 0
+				}
+				return conf.HTTPListener.Port
+			},
+			func(conf config.Config) any { return conf.HTTPListener }),
+		b.source("mqtt_listener",
+			func(conf config.Config) int {
+				if conf.MQTTListener == nil {
+					return 0
+				}
+				return conf.MQTTListener.BrokerPort
+			},
+			func(conf config.Config) any { return conf.MQTTListener }),
+	}
+	dataSinks = []dataSink{
+		b.sink("prometheus",
+			func(conf config.Config) int {
+				if conf.Prometheus == nil {
+					return 0
+				}
+				return conf.Prometheus.Port
+			},
+			func(conf config.Config) any { return conf.Prometheus },
+			func(conf config.Config) config.SinkFilter { return conf.Prometheus.SinkFilter }),
+		b.sink("mqtt_publisher",
+			func(conf config.Config) int {
+				if conf.MQTTPublisher == nil {
+					return 0
+				}
+				return conf.MQTTPublisher.BrokerPort
+			},
+			func(conf config.Config) any { return conf.MQTTPublisher },
+			func(conf config.Config) config.SinkFilter { return conf.MQTTPublisher.SinkFilter }),
+	}
+	log.Logger = zerolog.New(b)
+	t.Cleanup(func() {
+		b.cancel()
+		<-b.stopped
+		dataSources, dataSinks, log.Logger = originalSources, originalSinks, originalLogger
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	go func() {
+		defer close(b.stopped)
+		Run(ctx, conf, b.reloads)
+	}()
+	b.waitLog(t, "Starting processing")
+}
+
+// stop stops the bridge, waiting for it to shut down
+func (b *fakeBridge) stop(t *testing.T) {
+	t.Helper()
+	b.cancel()
+	select {
+	case <-b.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the bridge to stop")
+	}
+}
+
+// reload reloads the config, waiting for the reload to be applied or rejected
+func (b *fakeBridge) reload(t *testing.T, conf config.Config) {
+	t.Helper()
+	b.reloads <- conf
+	b.waitLog(t, "Config reloaded", "keeping the current config")
+}
+
+func fakeConfig() config.Config {
+	return config.Config{
+		HTTPListener:    &config.HTTPListener{Port: 1},
+		MQTTListener:    &config.MQTTListener{BrokerPort: 2},
+		Prometheus:      &config.Prometheus{Port: 3},
+		MQTTPublisher:   &config.MQTTPublisher{BrokerPort: 4},
+		ShutdownTimeout: 100 * time.Millisecond,
+	}
+}
+
+func TestRun_Shutdown(t *testing.T) {
+	b := &fakeBridge{emit: map[string][]string{
+		"http_listener": {"AA:BB:CC:DD:EE:01", "AA:BB:CC:DD:EE:02"},
+		"mqtt_listener": {"AA:BB:CC:DD:EE:03"},
+	}}
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+	b.stop(t)
+
+	events := b.take()
+	lastSourceStop := max(slices.Index(events, "stop http_listener"), slices.Index(events, "stop mqtt_listener"))
+	firstSinkStop := min(slices.Index(events, "stop prometheus"), slices.Index(events, "stop mqtt_publisher"))
+	if slices.Index(events, "stop http_listener") < 0 || slices.Index(events, "stop mqtt_listener") < 0 || firstSinkStop < 0 {
+		t.Fatalf("expected all the sources and sinks to stop, got %v", events)
+	}
+	if lastSourceStop > firstSinkStop {
+		t.Errorf("expected the sources to stop before the sinks, got %v", events)
+	}
+	for _, sink := range []string{"prometheus", "mqtt_publisher"} {
+		for _, mac := range []string{"AA:BB:CC:DD:EE:01", "AA:BB:CC:DD:EE:02", "AA:BB:CC:DD:EE:03"} {
+			if received := slices.Index(events, "receive "+sink+" "+mac); received < 0 || received > slices.Index(events, "stop "+sink) {
+				t.Errorf("expected the queued measurement %s to reach %s before it stopped, got %v", mac, sink, events)
+			}
+		}
+	}
+}
+
+func TestRun_ShutdownTimeout(t *testing.T) {
+	b := &fakeBridge{hang: map[string]chan struct{}{"prometheus": make(chan struct{})}}
+	defer close(b.hang["prometheus"])
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+
+	start := time.Now()
+	b.stop(t)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected the stuck sink to be abandoned after the shutdown timeout, took %v", elapsed)
+	}
+	events := b.take()
+	if slices.Contains(events, "stop prometheus") {
+		t.Errorf("expected the stuck sink not to stop, got %v", events)
+	}
+	if !slices.Contains(events, "stop mqtt_publisher") {
+		t.Errorf("expected the other sink to be flushed, got %v", events)
+	}
+}
+
+func TestRun_ReloadFilterOnly(t *testing.T) {
+	b := &fakeBridge{}
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+
+	conf := fakeConfig()
+	conf.Prometheus.ExcludeFields = []string{"diagnostics"}
+	conf.Tags = map[string]config.Tag{"AABBCCDDEEFF": {Name: "Sauna", Room: "Downstairs"}}
+	conf.TagNames = map[string]string{"112233445566": "Kitchen"}
+	b.reload(t, conf)
+	if events := b.take(); len(events) != 0 {
+		t.Errorf("expected a filter and tag change to restart nothing, got %v", events)
+	}
+}
+
+func TestRun_ReloadChangedSection(t *testing.T) {
+	b := &fakeBridge{}
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+
+	conf := fakeConfig()
+	conf.HTTPListener.Port = 5
+	conf.MQTTPublisher.BrokerPort = 6
+	b.reload(t, conf)
+	expected := []string{"stop http_listener", "start http_listener 5", "stop mqtt_publisher", "start mqtt_publisher 6"}
+	if events := b.take(); !slices.Equal(events, expected) {
+		t.Errorf("expected only the changed components to restart, got %v", events)
+	}
+}
+
+func TestRun_ReloadFallback(t *testing.T) {
+	b := &fakeBridge{busy: map[int]bool{5: true, 7: true}}
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+
+	conf := fakeConfig()
+	conf.HTTPListener.Port = 5
+	conf.Prometheus.Port = 7
+	b.reload(t, conf)
+	expected := []string{
+		"stop http_listener", "start http_listener 5", "start http_listener 1",
+		"stop prometheus", "start prometheus 7", "start prometheus 3",
+	}
+	if events := b.take(); !slices.Equal(events, expected) {
+		t.Errorf("expected the components to fall back to the previous config, got %v", events)
+	}
+
+	b.setBusy(5, false)
+	b.setBusy(7, false)
+	b.reload(t, conf)
+	expected = []string{"stop http_listener", "start http_listener 5", "stop prometheus", "start prometheus 7"}
+	if events := b.take(); !slices.Equal(events, expected) {
+		t.Errorf("expected the components to be retried with the new config, got %v", events)
+	}
+
+	b.reload(t, conf)
+	if events := b.take(); len(events) != 0 {
+		t.Errorf("expected the components running as configured not to restart, got %v", events)
+	}
+}
+
+func TestRun_ReloadStillStopping(t *testing.T) {
+	b := &fakeBridge{hang: map[string]chan struct{}{"http_listener": make(chan struct{}), "mqtt_publisher": make(chan struct{})}}
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+
+	conf := fakeConfig()
+	conf.HTTPListener.Port = 5
+	conf.MQTTPublisher.BrokerPort = 6
+	b.reload(t, conf)
+	if events := b.take(); len(events) != 0 {
+		t.Errorf("expected the components still stopping not to be started, got %v", events)
+	}
+
+	close(b.hang["http_listener"]) // the components finish stopping in the background
+	close(b.hang["mqtt_publisher"])
+	b.reload(t, conf)
+	events := b.take()
+	slices.Sort(events)
+	expected := []string{"start http_listener 5", "start mqtt_publisher 6", "stop http_listener", "stop mqtt_publisher"}
+	if !slices.Equal(events, expected) {
+		t.Errorf("expected the components to be restarted once stopped, got %v", events)
+	}
+}
+
+func TestRun_ReloadInvalid(t *testing.T) {
+	b := &fakeBridge{}
+	startFakeBridge(t, fakeConfig(), b)
+	b.take()
+
+	conf := fakeConfig()
+	conf.HTTPListener.Port = 5
+	conf.Processing = &config.Processing{FilterMode: "bogus"}
+	b.reload(t, conf)
+	if events := b.take(); len(events) != 0 {
+		t.Errorf("expected an invalid config to change nothing, got %v", events)
+	}
+
+	b.reload(t, fakeConfig())
+	if events := b.take(); len(events) != 0 {
+		t.Errorf("expected the current config to be kept, got %v", events)
+	}
+}
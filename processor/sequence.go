@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// sequenceOutOfOrderTolerance is how many steps the counter may go backwards before it is considered a reboot
+// rather than a late or out of order measurement, for example one relayed by a slower gateway. A counter going back to
+// zero, or going backwards twice in a row, is considered a reboot as well, as the tag may reboot while its counter is
+// still within the tolerance
+const sequenceOutOfOrderTolerance = 8
+
+// maxTrackedTags limits how many tags the trackers keep state for. The mac address of a measurement is not
+// authenticated, so the state of all tags is forgotten when the limit is reached, rather than letting spoofed or
+// randomized mac addresses grow the maps
+const maxTrackedTags = 1024
+
+type sequenceState struct {
+	dataFormat string
+	raw        int64
+	continuous int64
+	late       bool // whether the previous measurement was late
+}
+
+// sequenceTracker reconstructs a monotonic sequence number from the wrapping measurement sequence counters of the tags
+type sequenceTracker struct {
+	tags map[string]*sequenceState
+}
+
+func newSequenceTracker() *sequenceTracker {
+	return &sequenceTracker{tags: make(map[string]*sequenceState)}
+}
+
+// sequenceRange returns the number of distinct values the measurement sequence counter of the format can have
+func sequenceRange(dataFormat string) int64 {
+	switch dataFormat {
+	case "6", "ATC1441", "PVVX":
+		return 1 << 8
+	case "5", "8", "C5":
+		return 1<<16 - 1 // 0xFFFF means not available
+	case "E1":
+		return 1<<24 - 1 // 0xFFFFFF means not available
+	default:
+		return 0
+	}
+}
+
+// update sets the continuous sequence number of the measurement, based on the previous measurements of the tag
+func (t *sequenceTracker) update(m *parser.Measurement) {
+	dataFormat := m.FormatName()
+	seqRange := sequenceRange(dataFormat)
+	if m.MeasurementSequenceNumber == nil || seqRange == 0 {
+		return
+	}
+	raw := *m.MeasurementSequenceNumber
+	state, ok := t.tags[m.Mac]
+	if !ok || state.dataFormat != dataFormat {
+		if !ok && len(t.tags) >= maxTrackedTags {
+			t.tags = make(map[string]*sequenceState)
+		}
+		state = &sequenceState{dataFormat: dataFormat, raw: raw, continuous: raw}
+		t.tags[m.Mac] = state
+		m.ContinuousSequenceNumber = &raw
+		return
+	}
+
+	delta := ((raw-state.raw)%seqRange + seqRange) % seqRange
+	continuous := state.continuous
+	switch {
+	case delta <= seqRange/2:
+		state.raw = raw
+		state.continuous += delta
+		state.late = false
+		continuous = state.continuous
+	case seqRange-delta <= sequenceOutOfOrderTolerance && raw != 0 && !state.late:
+		state.late = true
+		continuous -= seqRange - delta // late measurement, don't move the state backwards
+	default:
+		log.Debug().Str("mac", m.Mac).Int64("previous", state.raw).Int64("current", raw).Msg("Sequence number jumped backwards, assuming the tag rebooted")
+		state.raw = raw
+		state.continuous = raw
+		state.late = false
+		continuous = raw
+	}
+	m.ContinuousSequenceNumber = &continuous
+}
@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func TestSequenceTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   int64
+		raw      []int64
+		expected []int64
+	}{
+		{"format 6 wraps", 6, []int64{250, 253, 255, 0, 4, 130, 250, 3}, []int64{250, 253, 255, 256, 260, 386, 506, 515}},
+		{"format 6 late measurement", 6, []int64{10, 12, 11, 13}, []int64{10, 12, 11, 13}},
+		{"format 6 reboot", 6, []int64{100, 101, 0, 1}, []int64{100, 101, 0, 1}},
+		{"format 6 reboot to zero within tolerance", 6, []int64{250, 255, 3, 5, 0, 1}, []int64{250, 255, 259, 261, 0, 1}},
+		{"format 6 reboot within tolerance", 6, []int64{250, 255, 3, 5, 1, 2, 3}, []int64{250, 255, 259, 261, 257, 2, 3}},
+		{"format 5 wraps", 5, []int64{65530, 65534, 2}, []int64{65530, 65534, 65537}},
+		{"format 5 reboot", 5, []int64{10000, 10001, 0}, []int64{10000, 10001, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newSequenceTracker()
+			for i, raw := range test.raw {
+				m := parser.Measurement{}
+				m.Mac = "AA:BB:CC:DD:EE:FF"
+				m.DataFormat = test.format
+				m.MeasurementSequenceNumber = &raw
+				tracker.update(&m)
+				if m.ContinuousSequenceNumber == nil {
+					t.Fatalf("measurement %d: got nil want %d", i, test.expected[i])
+				}
+				if *m.ContinuousSequenceNumber != test.expected[i] {
+					t.Errorf("measurement %d: got %d want %d", i, *m.ContinuousSequenceNumber, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSequenceTracker_UnsupportedFormat(t *testing.T) {
+	tracker := newSequenceTracker()
+	raw := int64(5)
+	m := parser.Measurement{}
+	m.DataFormat = 3
+	m.MeasurementSequenceNumber = &raw
+	tracker.update(&m)
+	if m.ContinuousSequenceNumber != nil {
+		t.Errorf("expected nil, got %v", *m.ContinuousSequenceNumber)
+	}
+}
+
+func TestSequenceTracker_MaxTags(t *testing.T) {
+	tracker := newSequenceTracker()
+	raw := int64(5)
+	for i := 0; i <= maxTrackedTags; i++ {
+		m := parser.Measurement{}
+		m.Mac = fmt.Sprintf("AA:BB:CC:DD:%02X:%02X", i>>8, i&0xff)
+		m.DataFormat = 5
+		m.MeasurementSequenceNumber = &raw
+		tracker.update(&m)
+	}
+	if len(tracker.tags) != 1 {
+		t.Errorf("expected the tags to be forgotten at the limit, got %d tags", len(tracker.tags))
+	}
+}
@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// settings are the processing options derived from the config, which are applied without restarting the sources and
+// sinks when the config is reloaded
+type settings struct {
+	tagNames          map[string]string
+	tags              map[string]config.Tag
+	extendedValues    bool
+	includeUnofficial bool
+	filterMap         map[string]any
+	allowlist         bool
+	denylist          bool
+	namedOnly         bool
+	gatewayFilterMap  map[string]any
+	gatewayAllowlist  bool
+	gatewayDenylist   bool
+	macMismatch       string
+	disabledFormats   []string
+	dedupeWindow      time.Duration
+	encryptionKeys    map[string][]byte
+	calibrations      map[string]tagCalibration
+	sinkFilters       []*sinkFilter // by the index of the sink in dataSinks
+	outlierRules      *outlierRules
+}
+
+// newSettings validates the processing options of the config, and the config sections of the enabled sources and sinks
+func newSettings(conf config.Config) (*settings, error) {
+	s := &settings{
+		tagNames:         conf.TagNames,
+		tags:             make(map[string]config.Tag),
+		extendedValues:   true, // default
+		filterMap:        make(map[string]any),
+		gatewayFilterMap: make(map[string]any),
+		macMismatch:      "flag", // default
+		encryptionKeys:   make(map[string][]byte),
+		calibrations:     make(map[string]tagCalibration),
+		sinkFilters:      make([]*sinkFilter, len(dataSinks)),
+	}
+	named := len(conf.TagNames) > 0
+	for mac, tag := range conf.Tags {
+		for _, key := range []string{"location", "room", "floor", "owner"} {
+			if _, ok := tag.Metadata[key]; ok {
+				return nil, fmt.Errorf("metadata key %q of %s is reserved, use the %s setting of the tag instead", key, mac, key)
+			}
+		}
+		s.tags[strings.ToUpper(strings.ReplaceAll(mac, ":", ""))] = tag
+		named = named || tag.Name != ""
+	}
+	if conf.Processing != nil {
+		processing := conf.Processing
+		if processing.ExtendedValues != nil {
+			s.extendedValues = *processing.ExtendedValues
+		}
+		s.includeUnofficial = processing.IncludeUnofficial
+		switch processing.FilterMode {
+		case "allowlist":
+			s.allowlist = true
+			if len(processing.FilterList) == 0 {
+				return nil, errors.New("filter_mode configured as allowlist but no allowed tags configured")
+			}
+		case "denylist":
+			s.denylist = true
+			if len(processing.FilterList) == 0 {
+				return nil, errors.New("filter_mode configured as denylist but no denied tags configured")
+			}
+		case "named":
+			s.namedOnly = true
+			if !named {
+				return nil, errors.New("filter_mode configured as named but no tag names configured")
+			}
+		case "none":
+		default:
+			return nil, fmt.Errorf("unrecognized filter_mode: %q", processing.FilterMode)
+		}
+		switch processing.GatewayFilterMode {
+		case "allowlist":
+			s.gatewayAllowlist = true
+			if len(processing.GatewayFilterList) == 0 {
+				return nil, errors.New("gateway_filter_mode configured as allowlist but no allowed gateways configured")
+			}
+		case "denylist":
+			s.gatewayDenylist = true
+			if len(processing.GatewayFilterList) == 0 {
+				return nil, errors.New("gateway_filter_mode configured as denylist but no denied gateways configured")
+			}
+		case "none", "":
+		default:
+			return nil, fmt.Errorf("unrecognized gateway_filter_mode: %q", processing.GatewayFilterMode)
+		}
+		for _, mac := range processing.GatewayFilterList {
+			formattedMac := strings.ToUpper(strings.ReplaceAll(mac, ":", ""))
+			s.gatewayFilterMap[formattedMac] = struct{}{}
+		}
+		switch processing.MacMismatch {
+		case "flag", "drop", "none":
+			s.macMismatch = processing.MacMismatch
+		case "":
+		default:
+			return nil, fmt.Errorf("unrecognized mac_mismatch: %q", processing.MacMismatch)
+		}
+		registeredFormats := parser.RegisteredFormats()
+		for _, format := range processing.DisableFormats {
+			if !slices.Contains(registeredFormats, format) {
+				log.Warn().Str("data_format", format).Strs("registered_formats", registeredFormats).Msg("Unrecognized format in disable_formats")
+			}
+		}
+		s.disabledFormats = processing.DisableFormats
+		s.dedupeWindow = processing.DedupeWindow
+		outlierRules, err := newOutlierRules(processing.OutlierRejection)
+		if err != nil {
+			return nil, err
+		}
+		s.outlierRules = outlierRules
+		for _, mac := range processing.FilterList {
+			formattedMac := strings.ToUpper(strings.ReplaceAll(mac, ":", ""))
+			s.filterMap[formattedMac] = struct{}{}
+		}
+	}
+
+	for mac, key := range conf.EncryptionKeys {
+		decoded, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key for %s: %w", mac, err)
+		}
+		if len(decoded) != 16 {
+			return nil, fmt.Errorf("invalid encryption key length for %s: got %d bytes, expected 16", mac, len(decoded))
+		}
+		s.encryptionKeys[mac] = decoded
+	}
+
+	for mac, calibration := range conf.Calibration {
+		c, err := newTagCalibration(calibration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid calibration for %s: %w", mac, err)
+		}
+		s.calibrations[strings.ToUpper(strings.ReplaceAll(mac, ":", ""))] = c
+	}
+
+	for _, source := range dataSources {
+		if source.enabled(conf) && source.validate != nil {
+			if err := source.validate(conf); err != nil {
+				return nil, fmt.Errorf("invalid config for %s: %w", source.name, err)
+			}
+		}
+	}
+
+	for i, sink := range dataSinks {
+		if !sink.enabled(conf) {
+			continue
+		}
+		if sink.validate != nil {
+			if err := sink.validate(conf); err != nil {
+				return nil, fmt.Errorf("invalid config for %s: %w", sink.name, err)
+			}
+		}
+		filter, err := newSinkFilter(sink.filter(conf))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter for %s: %w", sink.name, err)
+		}
+		s.sinkFilters[i] = filter
+	}
+	return s, nil
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Scrin/RuuviBridge/config"
+)
+
+func TestNewSettings(t *testing.T) {
+	s, err := newSettings(config.Config{
+		Processing: &config.Processing{
+			FilterMode:        "allowlist",
+			FilterList:        []string{"aa:bb:cc:dd:ee:ff"},
+			GatewayFilterMode: "denylist",
+			GatewayFilterList: []string{"11:22:33:44:55:66"},
+			DedupeWindow:      time.Second,
+		},
+		EncryptionKeys: map[string]string{"AABBCCDDEEFF": "000102030405060708090a0b0c0d0e0f"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.allowlist || s.denylist || !s.gatewayDenylist || s.gatewayAllowlist {
+		t.Errorf("unexpected filter modes: %+v", s)
+	}
+	if _, ok := s.filterMap["AABBCCDDEEFF"]; !ok {
+		t.Errorf("expected the filter list to be normalized, got %v", s.filterMap)
+	}
+	if _, ok := s.gatewayFilterMap["112233445566"]; !ok {
+		t.Errorf("expected the gateway filter list to be normalized, got %v", s.gatewayFilterMap)
+	}
+	if !s.extendedValues || s.macMismatch != "flag" || s.dedupeWindow != time.Second {
+		t.Errorf("unexpected defaults: %+v", s)
+	}
+	if len(s.encryptionKeys["AABBCCDDEEFF"]) != 16 {
+		t.Errorf("expected a decoded encryption key, got %v", s.encryptionKeys)
+	}
+}
+
+func TestNewSettings_Tags(t *testing.T) {
+	s, err := newSettings(config.Config{
+		Processing: &config.Processing{FilterMode: "named"},
+		Tags:       map[string]config.Tag{"aa:bb:cc:dd:ee:ff": {Name: "Kitchen", Room: "Kitchen"}},
+	})
+	if err != nil {
+		t.Fatalf("expected the names in tags to satisfy the named filter_mode, got %v", err)
+	}
+	if tag, ok := s.tags["AABBCCDDEEFF"]; !ok || tag.Room != "Kitchen" {
+		t.Errorf("expected the tags to be keyed by the normalized mac, got %v", s.tags)
+	}
+
+	if _, err := newSettings(config.Config{
+		Processing: &config.Processing{FilterMode: "named"},
+		Tags:       map[string]config.Tag{"AABBCCDDEEFF": {Room: "Kitchen"}},
+	}); err == nil {
+		t.Errorf("expected an error when none of the tags are named")
+	}
+}
+
+func TestNewSettings_Invalid(t *testing.T) {
+	configs := map[string]config.Config{
+		"empty allowlist":      {Processing: &config.Processing{FilterMode: "allowlist"}},
+		"named without names":  {Processing: &config.Processing{FilterMode: "named"}},
+		"unknown filter mode":  {Processing: &config.Processing{FilterMode: "something"}},
+		"unknown gateway mode": {Processing: &config.Processing{FilterMode: "none", GatewayFilterMode: "something"}},
+		"unknown mac_mismatch": {Processing: &config.Processing{FilterMode: "none", MacMismatch: "something"}},
+		"invalid key":          {EncryptionKeys: map[string]string{"AABBCCDDEEFF": "not hex"}},
+		"short key":            {EncryptionKeys: map[string]string{"AABBCCDDEEFF": "0001"}},
+		"no polled gateways":   {GatewayPolling: &config.GatewayPolling{}},
+		"missing recording":    {Replay: &config.Replay{File: "testdata/missing.jsonl"}},
+		"reserved label":       {Prometheus: &config.Prometheus{MetadataLabels: []string{"mac"}}},
+		"missing certificate":  {HTTPListener: &config.HTTPListener{TLSCertFile: "testdata/missing.pem", TLSKeyFile: "testdata/missing.key"}},
+		"unknown broker url":   {MQTTListener: &config.MQTTListener{BrokerUrl: "http://localhost:1883"}},
+		"reserved influx tag": {
+			InfluxDB3Publisher: &config.InfluxDB3Publisher{},
+			Tags:               map[string]config.Tag{"AABBCCDDEEFF": {Metadata: map[string]string{"dataFormat": "5"}}},
+		},
+		"additional influx tag": {
+			InfluxDBPublisher: &config.InfluxDBPublisher{AdditionalTags: map[string]string{"building": "A"}},
+			Tags:              map[string]config.Tag{"AABBCCDDEEFF": {Metadata: map[string]string{"building": "B"}}},
+		},
+		"additional influx tag room": {
+			InfluxDB3Publisher: &config.InfluxDB3Publisher{AdditionalTags: map[string]string{"room": "Kitchen"}},
+			Tags:               map[string]config.Tag{"AABBCCDDEEFF": {Room: "Sauna"}},
+		},
+		"metadata room": {Tags: map[string]config.Tag{"AABBCCDDEEFF": {Metadata: map[string]string{"room": "Sauna"}}}},
+	}
+	for name, conf := range configs {
+		if _, err := newSettings(conf); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
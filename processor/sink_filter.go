@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// fieldGroups are the names of the groups of measurement fields, which can be used in include_fields and
+// exclude_fields instead of listing each field
+var fieldGroups = map[string]string{
+	"BasicEnvironmentalData": "basic",
+	"AirQualityData":         "air_quality",
+	"DiagnosticsData":        "diagnostics",
+	"UnofficialData":         "unofficial",
+	"SensorData":             "sensor",
+	"CalculatedData":         "calculated",
+	"AdvertisementData":      "advertisement",
+}
+
+// measurementFields maps the JSON names of the measurement fields and the names of the field groups to the indexes of
+// the fields, for clearing them by reflection. Only the fields in the groups are included: the common data identifies
+// the measurement and its format, source and tag metadata, so it is never removed by the sink filters
+var measurementFields = func() map[string][][2]int {
+	fields := make(map[string][][2]int)
+	t := reflect.TypeOf(parser.Measurement{})
+	for i := 0; i < t.NumField(); i++ {
+		embedded := t.Field(i)
+		group, ok := fieldGroups[embedded.Name]
+		if !ok {
+			continue
+		}
+		for j := 0; j < embedded.Type.NumField(); j++ {
+			name, _, _ := strings.Cut(embedded.Type.Field(j).Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			index := [2]int{i, j} // the embedded struct and the field in it
+			fields[name] = append(fields[name], index)
+			fields[group] = append(fields[group], index)
+		}
+	}
+	return fields
+}()
+
+// sinkFilter limits the measurements and the fields passed to a single sink
+type sinkFilter struct {
+	filterMap       map[string]any
+	allowlist       bool
+	denylist        bool
+	disabledFormats []string
+	clearFields     map[[2]int]bool
+}
+
+// newSinkFilter validates the filter options of a sink. Returns nil if the sink does not filter anything
+func newSinkFilter(conf config.SinkFilter) (*sinkFilter, error) {
+	f := &sinkFilter{filterMap: make(map[string]any), clearFields: make(map[[2]int]bool)}
+	switch conf.FilterMode {
+	case "allowlist":
+		f.allowlist = true
+		if len(conf.FilterList) == 0 {
+			return nil, errors.New("filter_mode configured as allowlist but no allowed tags configured")
+		}
+	case "denylist":
+		f.denylist = true
+		if len(conf.FilterList) == 0 {
+			return nil, errors.New("filter_mode configured as denylist but no denied tags configured")
+		}
+	case "none", "":
+	default:
+		return nil, fmt.Errorf("unrecognized filter_mode: %q", conf.FilterMode)
+	}
+	for _, mac := range conf.FilterList {
+		formattedMac := strings.ToUpper(strings.ReplaceAll(mac, ":", ""))
+		f.filterMap[formattedMac] = struct{}{}
+	}
+
+	registeredFormats := parser.RegisteredFormats()
+	for _, format := range conf.DisableFormats {
+		if !slices.Contains(registeredFormats, format) {
+			log.Warn().Str("data_format", format).Strs("registered_formats", registeredFormats).Msg("Unrecognized format in disable_formats")
+		}
+	}
+	f.disabledFormats = conf.DisableFormats
+
+	for _, name := range slices.Concat(conf.IncludeFields, conf.ExcludeFields) {
+		if _, ok := measurementFields[name]; !ok {
+			return nil, fmt.Errorf("unrecognized field in include_fields or exclude_fields: %q", name)
+		}
+	}
+	if len(conf.IncludeFields) > 0 {
+		for _, indexes := range measurementFields {
+			for _, index := range indexes {
+				f.clearFields[index] = true
+			}
+		}
+		for _, name := range conf.IncludeFields {
+			for _, index := range measurementFields[name] {
+				delete(f.clearFields, index)
+			}
+		}
+	}
+	for _, name := range conf.ExcludeFields {
+		for _, index := range measurementFields[name] {
+			f.clearFields[index] = true
+		}
+	}
+
+	if !f.allowlist && !f.denylist && len(f.disabledFormats) == 0 && len(f.clearFields) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// apply returns the measurement with the excluded fields removed, or false if the measurement is not passed to the sink
+func (f *sinkFilter) apply(m parser.Measurement) (parser.Measurement, bool) {
+	if f == nil {
+		return m, true
+	}
+	_, isOnList := f.filterMap[strings.ToUpper(strings.ReplaceAll(m.Mac, ":", ""))]
+	if (f.denylist && isOnList) || (f.allowlist && !isOnList) {
+		return m, false
+	}
+	if slices.Contains(f.disabledFormats, m.FormatName()) {
+		return m, false
+	}
+	v := reflect.ValueOf(&m).Elem()
+	for index := range f.clearFields {
+		v.Field(index[0]).Field(index[1]).SetZero()
+	}
+	return m, true
+}
@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Scrin/RuuviBridge/config"
+	"github.com/Scrin/RuuviBridge/parser"
+)
+
+func sinkFilterMeasurement() parser.Measurement {
+	name, timestamp, temperature, humidity, dewPoint, parseFailures := "Sauna", int64(1704110400), 80.5, 10.0, 12.3, int64(1)
+	m := parser.Measurement{}
+	m.Name = &name
+	m.Mac = "AA:BB:CC:DD:EE:FF"
+	m.Timestamp = &timestamp
+	m.DataFormat = 5
+	m.Temperature = &temperature
+	m.Humidity = &humidity
+	m.DewPoint = &dewPoint
+	m.ParseFailures = &parseFailures
+	return m
+}
+
+func TestSinkFilter_Tags(t *testing.T) {
+	f, err := newSinkFilter(config.SinkFilter{FilterMode: "allowlist", FilterList: []string{"aa:bb:cc:dd:ee:ff"}, DisableFormats: []string{"3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.apply(sinkFilterMeasurement()); !ok {
+		t.Errorf("expected an allowed tag to pass")
+	}
+	other := sinkFilterMeasurement()
+	other.Mac = "11:22:33:44:55:66"
+	if _, ok := f.apply(other); ok {
+		t.Errorf("expected a tag not on the allowlist to be filtered out")
+	}
+	format3 := sinkFilterMeasurement()
+	format3.DataFormat = 3
+	if _, ok := f.apply(format3); ok {
+		t.Errorf("expected a disabled format to be filtered out")
+	}
+}
+
+func TestSinkFilter_Fields(t *testing.T) {
+	f, err := newSinkFilter(config.SinkFilter{ExcludeFields: []string{"diagnostics", "dewPoint"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := sinkFilterMeasurement()
+	m, ok := f.apply(original)
+	if !ok {
+		t.Fatalf("expected the measurement to pass")
+	}
+	if m.ParseFailures != nil || m.DewPoint != nil {
+		t.Errorf("expected the excluded fields to be removed, got %+v", m)
+	}
+	if m.Temperature == nil || m.Humidity == nil {
+		t.Errorf("expected the other fields to be kept, got %+v", m)
+	}
+	if original.ParseFailures == nil || original.DewPoint == nil {
+		t.Errorf("expected the original measurement to be left intact")
+	}
+
+	f, err = newSinkFilter(config.SinkFilter{IncludeFields: []string{"temperature"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ = f.apply(sinkFilterMeasurement())
+	if m.Temperature == nil || m.Humidity != nil || m.DewPoint != nil || m.ParseFailures != nil {
+		t.Errorf("expected only the included fields to be kept, got %+v", m)
+	}
+	if m.Name == nil || m.Mac == "" || m.Timestamp == nil || m.DataFormat != 5 {
+		t.Errorf("expected the identity fields to be kept, got %+v", m)
+	}
+}
+
+func TestSinkFilter_IncludeFieldsKeepsCommonData(t *testing.T) {
+	f, err := newSinkFilter(config.SinkFilter{IncludeFields: []string{"temperature"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatewayMac, receiveTime, location := "11:22:33:44:55:66", int64(1704110400000), "Cellar"
+	original := sinkFilterMeasurement()
+	original.DataFormat = 0
+	original.DataFormatName = "BTHome"
+	original.GatewayMac = &gatewayMac
+	original.SourceType = "mqtt_listener"
+	original.SourceName = "ruuvi_gateway"
+	original.ReceiveTime = &receiveTime
+	original.Location = &location
+	original.Metadata = map[string]string{"shelf": "top"}
+	m, ok := f.apply(original)
+	if !ok {
+		t.Fatalf("expected the measurement to pass")
+	}
+	if m.Temperature == nil || m.Humidity != nil {
+		t.Errorf("expected only the included fields to be kept, got %+v", m)
+	}
+	if !reflect.DeepEqual(m.CommonData, original.CommonData) {
+		t.Errorf("expected the common data to be kept, got %+v, want %+v", m.CommonData, original.CommonData)
+	}
+	if m.FormatName() != "BTHome" {
+		t.Errorf("expected the format name BTHome, got %q", m.FormatName())
+	}
+}
+
+func TestSinkFilter_Invalid(t *testing.T) {
+	if f, err := newSinkFilter(config.SinkFilter{}); f != nil || err != nil {
+		t.Errorf("expected no filter without options, got %v %v", f, err)
+	}
+	filters := map[string]config.SinkFilter{
+		"empty allowlist":     {FilterMode: "allowlist"},
+		"unknown filter mode": {FilterMode: "named"},
+		"unknown field":       {IncludeFields: []string{"temperatur"}},
+		"identity field":      {ExcludeFields: []string{"mac"}},
+		"format name field":   {ExcludeFields: []string{"data_format_name"}},
+		"metadata field":      {IncludeFields: []string{"temperature", "location"}},
+	}
+	for name, conf := range filters {
+		if _, err := newSinkFilter(conf); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}